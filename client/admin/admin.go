@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Client-specific constants
+const (
+	PathCalls      = "/admin/calls/"
+	ActionClose    = "close"
+	ActionDiscard  = "discard"
+	DefaultTimeout = 10 * time.Second
+)
+
+// CallStatus is a call tracked by the agent, as returned by the admin API
+type CallStatus struct {
+	model.Call
+	State string `json:"state"`
+}
+
+// Client is the client of the agent admin API
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient initializes a new admin API client
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}
+}
+
+// CloseCall force-closes a call at the given end time, publishing the end transaction
+func (c *Client) CloseCall(ctx context.Context, callID string, timestampEnd time.Time, reason string) (*CallStatus, error) {
+	req := &model.CloseCallRequest{
+		Reason: reason,
+	}
+	if !timestampEnd.IsZero() {
+		req.TimestampEnd = timestampEnd.UTC().Format(time.RFC3339)
+	}
+	return c.callAction(ctx, callID, ActionClose, req)
+}
+
+// DiscardCall discards a call without billing it
+func (c *Client) DiscardCall(ctx context.Context, callID string, reason string) (*CallStatus, error) {
+	req := &model.DiscardCallRequest{
+		Reason: reason,
+	}
+	return c.callAction(ctx, callID, ActionDiscard, req)
+}
+
+func (c *Client) callAction(ctx context.Context, callID, action string, req interface{}) (*CallStatus, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal request to JSON")
+	}
+
+	endpoint := c.baseURL + PathCalls + url.PathEscape(callID) + "/" + action
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the request")
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to reach the admin API")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		apiErr := struct {
+			Error string `json:"error"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			apiErr.Error = http.StatusText(res.StatusCode)
+		}
+		return nil, errors.Errorf("admin API error (%d): %s", res.StatusCode, apiErr.Error)
+	}
+
+	status := &CallStatus{}
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the response")
+	}
+	return status, nil
+}
@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+func TestCloseCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/admin/calls/call@example.com/close", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		req := &model.CloseCallRequest{}
+		err := json.NewDecoder(r.Body).Decode(req)
+		assert.Nil(t, err)
+		assert.Equal(t, "2020-03-14T09:00:00Z", req.TimestampEnd)
+		assert.Equal(t, "lost BYE", req.Reason)
+
+		w.Write([]byte(`{"transaction_tag": "call@example.com", "timestamp_bye": "2020-03-14T09:00:00Z", "state": "closed"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", "secret")
+	timestampEnd := time.Date(2020, 3, 14, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	call, err := client.CloseCall(context.Background(), "call@example.com", timestampEnd, "lost BYE")
+	assert.Nil(t, err)
+	assert.Equal(t, "call@example.com", call.TransactionTag)
+	assert.Equal(t, "closed", call.State)
+	assert.True(t, timestampEnd.Equal(call.TimestampBye))
+}
+
+func TestDiscardCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/calls/call-1/discard", r.URL.Path)
+		assert.Equal(t, "", r.Header.Get("Authorization"))
+
+		w.Write([]byte(`{"transaction_tag": "call-1", "state": "discarded"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+	call, err := client.DiscardCall(context.Background(), "call-1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", call.TransactionTag)
+	assert.Equal(t, "discarded", call.State)
+}
+
+func TestCallActionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/calls/unknown/discard" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "call not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret")
+	_, err := client.DiscardCall(context.Background(), "unknown", "")
+	assert.EqualError(t, err, "admin API error (404): call not found")
+
+	_, err = client.CloseCall(context.Background(), "call-1", time.Time{}, "")
+	assert.EqualError(t, err, "admin API error (502): Bad Gateway")
+
+	client = NewClient("http://localhost:1", "secret")
+	_, err = client.DiscardCall(context.Background(), "call-1", "")
+	assert.Error(t, err)
+}
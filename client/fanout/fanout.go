@@ -0,0 +1,261 @@
+package fanout
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/metrics"
+)
+
+// Client-specific constants
+const (
+	MaxRetryBackoff = time.Minute
+)
+
+var errClosed = errors.New("the publisher is closed")
+
+// Sink is a client the requests are published to
+type Sink struct {
+	// Name identifies the sink in the logs and in the metrics
+	Name string
+	// Client is the client publishing the requests
+	Client rabbitmq.ClientInterface
+	// Mandatory sinks are published synchronously and their failures are returned
+	// to the caller; optional sinks are published in background, from their own
+	// retry queue, and their failures are only logged
+	Mandatory bool
+}
+
+// Options are the options of the optional sinks
+type Options struct {
+	// QueueSize is the maximum number of requests waiting to be published, per sink
+	QueueSize int
+	// MaxRetries is the number of retries after the first failed attempt
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled at each retry
+	RetryBackoff time.Duration
+}
+
+type message struct {
+	routingKey string
+	req        interface{}
+}
+
+type sink struct {
+	Sink
+	queue     chan message
+	connected bool
+}
+
+// Client publishes the requests to several sinks, according to their policy
+type Client struct {
+	sinks   []*sink
+	options Options
+	mutex   sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewClient initializes a new fan-out client
+func NewClient(sinks []Sink, options Options) *Client {
+	if options.QueueSize < 1 {
+		options.QueueSize = 1
+	}
+	c := &Client{
+		options: options,
+	}
+	for _, s := range sinks {
+		c.sinks = append(c.sinks, &sink{Sink: s})
+	}
+	return c
+}
+
+// Connect connects the sinks and starts the workers of the optional ones; the
+// optional sinks which cannot be connected are connected again before publishing
+func (c *Client) Connect(ctx context.Context) error {
+	l := log.FromContext(ctx)
+	for i, s := range c.sinks {
+		err := s.Client.Connect(ctx)
+		if err != nil && s.Mandatory {
+			for _, connected := range c.sinks[:i] {
+				if connected.connected {
+					connected.Client.Close(ctx)
+					connected.connected = false
+				}
+			}
+			return errors.Wrapf(err, "unable to connect the sink %s", s.Name)
+		} else if err != nil {
+			l.WithFields(logrus.Fields{
+				"sink": s.Name,
+				"err":  err.Error(),
+			}).Warn("unable to connect the optional sink")
+		}
+		s.connected = err == nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = false
+	c.done = make(chan struct{})
+	for _, s := range c.sinks {
+		if !s.Mandatory {
+			s.queue = make(chan message, c.options.QueueSize)
+			c.workers.Add(1)
+			go c.work(s)
+		}
+	}
+	return nil
+}
+
+// Close stops accepting requests, waits for the optional sinks to publish the queued
+// requests, without retrying them, and closes the sinks
+func (c *Client) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.closed || c.done == nil {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	for _, s := range c.sinks {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	}
+	c.mutex.Unlock()
+	c.workers.Wait()
+
+	var err error
+	for _, s := range c.sinks {
+		if !s.connected {
+			continue
+		}
+		s.connected = false
+		if errClose := s.Client.Close(ctx); errClose != nil && err == nil {
+			err = errors.Wrapf(errClose, "unable to close the sink %s", s.Name)
+		}
+	}
+	return err
+}
+
+// Ping checks the mandatory sinks
+func (c *Client) Ping(ctx context.Context) error {
+	for _, s := range c.sinks {
+		if !s.Mandatory {
+			continue
+		}
+		if err := s.Client.Ping(ctx); err != nil {
+			return errors.Wrapf(err, "sink %s", s.Name)
+		}
+	}
+	return nil
+}
+
+// Publish queues the request for the optional sinks and publishes it with the
+// mandatory ones, returning their failures
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return errClosed
+	}
+
+	l := log.FromContext(ctx)
+	msg := message{routingKey: routingKey, req: req}
+	for _, s := range c.sinks {
+		if s.Mandatory || s.queue == nil {
+			continue
+		}
+		select {
+		case s.queue <- msg:
+			metrics.SinkQueueLength.WithLabelValues(s.Name).Inc()
+		default:
+			metrics.SinkDropped.WithLabelValues(s.Name).Inc()
+			l.WithFields(logrus.Fields{
+				"sink":        s.Name,
+				"routing-key": routingKey,
+			}).Error("the queue of the optional sink is full, dropping the request")
+		}
+	}
+
+	var errs []string
+	for _, s := range c.sinks {
+		if !s.Mandatory {
+			continue
+		}
+		if err := s.Client.Publish(ctx, routingKey, req); err != nil {
+			metrics.SinkFailures.WithLabelValues(s.Name).Inc()
+			errs = append(errs, s.Name+": "+err.Error())
+			continue
+		}
+		metrics.SinkPublished.WithLabelValues(s.Name).Inc()
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("unable to publish the request: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// work publishes the requests queued for an optional sink
+func (c *Client) work(s *sink) {
+	defer c.workers.Done()
+	for msg := range s.queue {
+		metrics.SinkQueueLength.WithLabelValues(s.Name).Dec()
+		c.deliver(s, msg)
+	}
+}
+
+// deliver publishes a request with an optional sink, retrying it with exponential backoff
+func (c *Client) deliver(s *sink, msg message) {
+	ctx := context.Background()
+	l := log.FromContext(ctx).WithFields(logrus.Fields{
+		"sink":        s.Name,
+		"routing-key": msg.routingKey,
+	})
+
+	backoff := c.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.publish(ctx, s, msg)
+		if err == nil {
+			metrics.SinkPublished.WithLabelValues(s.Name).Inc()
+			return
+		}
+		metrics.SinkFailures.WithLabelValues(s.Name).Inc()
+		if attempt >= c.options.MaxRetries {
+			metrics.SinkDropped.WithLabelValues(s.Name).Inc()
+			l.WithField("err", err.Error()).Error("unable to publish the request with the optional sink, dropping it")
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-c.done:
+			metrics.SinkDropped.WithLabelValues(s.Name).Inc()
+			l.WithField("err", err.Error()).Error("unable to publish the request with the optional sink before closing, dropping it")
+			return
+		}
+		metrics.SinkRetries.WithLabelValues(s.Name).Inc()
+		backoff *= 2
+		if backoff > MaxRetryBackoff {
+			backoff = MaxRetryBackoff
+		}
+	}
+}
+
+func (c *Client) publish(ctx context.Context, s *sink, msg message) error {
+	if !s.connected {
+		if err := s.Client.Connect(ctx); err != nil {
+			return errors.Wrap(err, "unable to connect")
+		}
+		s.connected = true
+	}
+	return s.Client.Publish(ctx, msg.routingKey, msg.req)
+}
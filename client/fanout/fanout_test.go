@@ -0,0 +1,236 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/metrics"
+)
+
+type fakeClient struct {
+	mutex      sync.Mutex
+	connectErr error
+	publishErr []error
+	pingErr    error
+	block      chan struct{}
+	connects   int
+	closes     int
+	published  []string
+}
+
+func (c *fakeClient) Connect(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connects++
+	err := c.connectErr
+	c.connectErr = nil
+	return err
+}
+
+func (c *fakeClient) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closes++
+	return nil
+}
+
+func (c *fakeClient) Ping(ctx context.Context) error {
+	return c.pingErr
+}
+
+func (c *fakeClient) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	if c.block != nil {
+		<-c.block
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.publishErr) > 0 {
+		err := c.publishErr[0]
+		c.publishErr = c.publishErr[1:]
+		return err
+	}
+	c.published = append(c.published, routingKey)
+	return nil
+}
+
+func (c *fakeClient) getPublished() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string{}, c.published...)
+}
+
+func TestClientPublish(t *testing.T) {
+	primary := &fakeClient{}
+	analytics := &fakeClient{
+		publishErr: []error{errors.New("unavailable"), errors.New("unavailable")},
+	}
+	client := NewClient([]Sink{
+		{Name: "test-primary", Client: primary, Mandatory: true},
+		{Name: "test-analytics", Client: analytics},
+	}, Options{
+		QueueSize:    10,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "begin_transaction", "request")
+	assert.Nil(t, err)
+
+	primary.publishErr = []error{errors.New("unreachable")}
+	err = client.Publish(ctx, "end_transaction", "request")
+	assert.EqualError(t, err, "unable to publish the request: test-primary: unreachable")
+
+	assert.Eventually(t, func() bool {
+		return len(analytics.getPublished()) == 2
+	}, time.Second, time.Millisecond)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"begin_transaction"}, primary.getPublished())
+	assert.Equal(t, []string{"begin_transaction", "end_transaction"}, analytics.getPublished())
+	assert.Equal(t, 1, primary.closes)
+	assert.Equal(t, 1, analytics.closes)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SinkPublished.WithLabelValues("test-primary")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SinkFailures.WithLabelValues("test-primary")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.SinkPublished.WithLabelValues("test-analytics")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.SinkFailures.WithLabelValues("test-analytics")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.SinkRetries.WithLabelValues("test-analytics")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.SinkDropped.WithLabelValues("test-analytics")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.SinkQueueLength.WithLabelValues("test-analytics")))
+
+	err = client.Publish(ctx, "begin_transaction", "request")
+	assert.Equal(t, errClosed, err)
+}
+
+func TestClientPublishRetriesExhausted(t *testing.T) {
+	primary := &fakeClient{}
+	analytics := &fakeClient{
+		publishErr: []error{errors.New("unavailable"), errors.New("unavailable")},
+	}
+	client := NewClient([]Sink{
+		{Name: "test-exhausted-primary", Client: primary, Mandatory: true},
+		{Name: "test-exhausted", Client: analytics},
+	}, Options{
+		QueueSize:    10,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "begin_transaction", "request")
+	assert.Nil(t, err)
+	err = client.Publish(ctx, "end_transaction", "request")
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(analytics.getPublished()) == 1
+	}, time.Second, time.Millisecond)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"begin_transaction", "end_transaction"}, primary.getPublished())
+	assert.Equal(t, []string{"end_transaction"}, analytics.getPublished())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SinkDropped.WithLabelValues("test-exhausted")))
+}
+
+func TestClientPublishQueueFull(t *testing.T) {
+	primary := &fakeClient{}
+	analytics := &fakeClient{
+		block: make(chan struct{}),
+	}
+	client := NewClient([]Sink{
+		{Name: "test-full-primary", Client: primary, Mandatory: true},
+		{Name: "test-full", Client: analytics},
+	}, Options{
+		QueueSize: 1,
+	})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	// the first request is taken by the worker, which blocks, the second one
+	// fills the queue and the third one is dropped
+	for i := 0; i < 3; i++ {
+		err = client.Publish(ctx, "begin_transaction", "request")
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, primary.getPublished(), 3)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SinkDropped.WithLabelValues("test-full")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SinkQueueLength.WithLabelValues("test-full")))
+
+	close(analytics.block)
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, analytics.getPublished(), 2)
+}
+
+func TestClientConnect(t *testing.T) {
+	primary := &fakeClient{}
+	optional := &fakeClient{
+		connectErr: errors.New("unreachable"),
+	}
+	mandatory := &fakeClient{}
+	client := NewClient([]Sink{
+		{Name: "test-connect-primary", Client: primary, Mandatory: true},
+		{Name: "test-connect-optional", Client: optional},
+		{Name: "test-connect-mandatory", Client: mandatory, Mandatory: true},
+	}, Options{})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	// the optional sink is connected again before publishing
+	err = client.Publish(ctx, "begin_transaction", "request")
+	assert.Nil(t, err)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, optional.connects)
+	assert.Equal(t, []string{"begin_transaction"}, optional.getPublished())
+	assert.Equal(t, []string{"begin_transaction"}, mandatory.getPublished())
+
+	// a mandatory sink which cannot be connected fails the connection
+	mandatory.connectErr = errors.New("unreachable")
+	err = client.Connect(ctx)
+	assert.EqualError(t, err, "unable to connect the sink test-connect-mandatory: unreachable")
+	assert.Equal(t, 2, primary.closes)
+	assert.Equal(t, 2, optional.closes)
+}
+
+func TestClientPing(t *testing.T) {
+	primary := &fakeClient{}
+	optional := &fakeClient{
+		pingErr: errors.New("unreachable"),
+	}
+	client := NewClient([]Sink{
+		{Name: "primary", Client: primary, Mandatory: true},
+		{Name: "optional", Client: optional},
+	}, Options{})
+
+	ctx := context.Background()
+	err := client.Ping(ctx)
+	assert.Nil(t, err)
+
+	primary.pingErr = errors.New("unreachable")
+	err = client.Ping(ctx)
+	assert.EqualError(t, err, "sink primary: unreachable")
+}
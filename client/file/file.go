@@ -0,0 +1,272 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/canyanio/rating-agent-hep/client/jsonl"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Supported file formats
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Client-specific constants
+const (
+	TagsSeparator = "|"
+	CDRPathSuffix = "-cdr"
+)
+
+// CSVHeader is the header of the CSV files
+var CSVHeader = []string{
+	"type",
+	"tenant",
+	"transaction_tag",
+	"account_tag",
+	"destination_account_tag",
+	"source",
+	"destination",
+	"product_tag",
+	"tags",
+	"timestamp_begin",
+	"timestamp_end",
+	"duration",
+}
+
+// CSVHeaderCDR is the header of the CSV files of the call detail records
+var CSVHeaderCDR = []string{
+	"tenant",
+	"transaction_tag",
+	"account_tag",
+	"destination_account_tag",
+	"source",
+	"destination",
+	"source_ip",
+	"destination_ip",
+	"capture_agent_id",
+	"capture_agent_name",
+	"direction",
+	"product_tag",
+	"tags",
+	"timestamp_invite",
+	"timestamp_answer",
+	"timestamp_end",
+	"duration",
+	"disposition",
+	"sip_final_code",
+	"jitter_avg",
+	"packet_loss_avg",
+	"mos_avg",
+	"mos_min",
+}
+
+// Options are the options of the file client
+type Options struct {
+	// Path is the path of the file
+	Path string
+	// Format is the format of the file, either jsonl or csv
+	Format string
+	// MaxSize is the size in bytes which triggers the rotation, zero disables it
+	MaxSize int64
+	// MaxAge is the age which triggers the rotation, zero disables it
+	MaxAge time.Duration
+	// Compress enables the gzip compression of the rotated files
+	Compress bool
+}
+
+// Client is a client which appends the published messages to a rotated file, as JSON
+// lines or CSV records; in CSV format, the call detail records are appended to a
+// distinct file, named adding CDRPathSuffix before the extension
+type Client struct {
+	options Options
+	file    *rotatingFile
+	cdrFile *rotatingFile
+	mutex   sync.Mutex
+}
+
+// NewClient initializes a new file client
+func NewClient(options Options) *Client {
+	if options.Format == "" {
+		options.Format = FormatJSONL
+	}
+	c := &Client{
+		options: options,
+		file:    newRotatingFile(options.Path, options.MaxSize, options.MaxAge, options.Compress),
+	}
+	if options.Format == FormatCSV {
+		c.cdrFile = newRotatingFile(CDRPath(options.Path), options.MaxSize, options.MaxAge, options.Compress)
+	}
+	return c
+}
+
+// CDRPath returns the path of the CSV file of the call detail records
+func CDRPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + CDRPathSuffix + ext
+}
+
+// Connect opens the file
+func (c *Client) Connect(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.options.Format != FormatCSV {
+		return c.file.open(nil)
+	}
+	header, err := encodeCSV(CSVHeader)
+	if err != nil {
+		return err
+	}
+	return c.file.open(header)
+}
+
+// Close closes the files
+func (c *Client) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.file.Close()
+	if c.cdrFile != nil {
+		if errCDR := c.cdrFile.Close(); err == nil {
+			err = errCDR
+		}
+	}
+	return err
+}
+
+// Ping checks the file is open
+func (c *Client) Ping(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.file.file == nil {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// Publish appends a message to the file
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.file.file == nil {
+		return errors.New("not connected")
+	}
+
+	var data []byte
+	var err error
+	file := c.file
+	if c.options.Format == FormatCSV {
+		if cdr, ok := req.(*model.CallDetailRecord); ok {
+			file = c.cdrFile
+			if err = c.openCDRFile(); err == nil {
+				data, err = encodeCSV(csvRecordCDR(cdr))
+			}
+		} else {
+			var record []string
+			if record, err = csvRecord(routingKey, req); err == nil {
+				data, err = encodeCSV(record)
+			}
+		}
+	} else {
+		data, err = json.Marshal(&jsonl.Line{
+			RoutingKey: routingKey,
+			Request:    req,
+		})
+		if err != nil {
+			err = errors.Wrap(err, "unable to marshal request to JSON")
+		}
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return errors.Wrap(err, "unable to write the request")
+	}
+	return nil
+}
+
+// openCDRFile opens the CSV file of the call detail records, when the first one is
+// written
+func (c *Client) openCDRFile() error {
+	if c.cdrFile.file != nil {
+		return nil
+	}
+	header, err := encodeCSV(CSVHeaderCDR)
+	if err != nil {
+		return err
+	}
+	return c.cdrFile.open(header)
+}
+
+func csvRecord(routingKey string, req interface{}) ([]string, error) {
+	switch r := req.(type) {
+	case *model.BeginTransaction:
+		return []string{
+			routingKey, r.Request.Tenant, r.Request.TransactionTag, r.Request.AccountTag,
+			r.Request.DestinationAccountTag, r.Request.Source, r.Request.Destination,
+			r.Request.ProductTag, strings.Join(r.Request.Tags, TagsSeparator),
+			r.Request.TimestampBegin, "", "",
+		}, nil
+	case *model.EndTransaction:
+		return []string{
+			routingKey, r.Request.Tenant, r.Request.TransactionTag, r.Request.AccountTag,
+			r.Request.DestinationAccountTag, "", "", "", "", "", r.Request.TimestampEnd, "",
+		}, nil
+	}
+	return nil, errors.Errorf("unsupported request type for %s: %T", routingKey, req)
+}
+
+func csvRecordCDR(r *model.CallDetailRecord) []string {
+	record := []string{
+		r.Tenant, r.TransactionTag, r.AccountTag, r.DestinationAccountTag,
+		r.Source, r.Destination, r.SourceIP, r.DestinationIP,
+		formatUint(uint64(r.CaptureAgentID)), r.CaptureAgentName, r.Direction,
+		r.ProductTag, strings.Join(r.Tags, TagsSeparator),
+		r.TimestampInvite, r.TimestampAnswer, r.TimestampEnd,
+		strconv.FormatInt(r.Duration, 10), r.Disposition, formatUint(uint64(r.SIPFinalCode)),
+	}
+	if r.Quality == nil {
+		return append(record, "", "", "", "")
+	}
+	return append(record,
+		formatFloat(r.Quality.JitterAvg), formatFloat(r.Quality.PacketLossAvg),
+		formatFloat(r.Quality.MOSAvg), formatFloat(r.Quality.MOSMin))
+}
+
+// formatUint formats the optional numeric fields, empty if zero
+func formatUint(value uint64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatUint(value, 10)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func encodeCSV(record []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write(record); err != nil {
+		return nil, errors.Wrap(err, "unable to encode the CSV record")
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
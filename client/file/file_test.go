@@ -0,0 +1,291 @@
+package file
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+var (
+	testBegin = &model.BeginTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.BeginTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+			Source:         "sip:1000@example.com",
+			Destination:    "sip:2000@example.com",
+			ProductTag:     "VOICE",
+			Tags:           []string{"tag1", "tag2"},
+			TimestampBegin: "2020-03-14T08:56:08Z",
+		},
+	}
+	testEnd = &model.EndTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+			TimestampEnd:   "2020-03-14T08:57:10Z",
+		},
+	}
+	testCDR = &model.CallDetailRecord{
+		SchemaVersion:    model.CallDetailRecordSchemaVersion,
+		Tenant:           "default",
+		TransactionTag:   "call-1",
+		AccountTag:       "1000",
+		Source:           "sip:1000@example.com",
+		Destination:      "sip:2000@example.com",
+		SourceIP:         "10.0.0.2",
+		DestinationIP:    "10.0.0.1",
+		CaptureAgentID:   2001,
+		CaptureAgentName: "edge-proxy",
+		ProductTag:       "VOICE",
+		Tags:             []string{"tag1", "tag2"},
+		TimestampInvite:  "2020-03-14T08:56:05Z",
+		TimestampAnswer:  "2020-03-14T08:56:08Z",
+		TimestampEnd:     "2020-03-14T08:57:10Z",
+		Duration:         62,
+		Disposition:      model.DispositionAnswered,
+		SIPFinalCode:     200,
+		Quality: &model.QualitySummary{
+			Samples:       2,
+			JitterAvg:     12.5,
+			PacketLossAvg: 0.5,
+			MOSAvg:        4.3,
+			MOSMin:        4.2,
+		},
+	}
+)
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "file")
+	assert.Nil(t, err)
+	return dir
+}
+
+func TestClientJSONL(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cdr.jsonl")
+
+	client := NewClient(Options{
+		Path: path,
+	})
+
+	ctx := context.Background()
+	err := client.Ping(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Ping(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, testBegin)
+	assert.Nil(t, err)
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+	err = client.Publish(ctx, rabbitmq.QueueNameCallDetailRecord, testCDR)
+	assert.Nil(t, err)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, `{"routing_key":"begin_transaction","request":{"schema_version":"1.3","request":{"tenant":"default",`+
+			`"transaction_tag":"call-1","account_tag":"1000","destination_account_tag":"",`+
+			`"source":"sip:1000@example.com","destination":"sip:2000@example.com","product_tag":"VOICE",`+
+			`"tags":["tag1","tag2"],"timestamp_begin":"2020-03-14T08:56:08Z"}}}`, lines[0])
+
+		line := &struct {
+			RoutingKey string                  `json:"routing_key"`
+			Request    *model.CallDetailRecord `json:"request"`
+		}{}
+		err = json.Unmarshal([]byte(lines[2]), line)
+		assert.Nil(t, err)
+		assert.Equal(t, rabbitmq.QueueNameCallDetailRecord, line.RoutingKey)
+		assert.Equal(t, testCDR, line.Request)
+	}
+}
+
+func TestClientCSV(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cdr.csv")
+
+	client := NewClient(Options{
+		Path:   path,
+		Format: FormatCSV,
+	})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, testBegin)
+	assert.Nil(t, err)
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameCallDetailRecord, testCDR)
+	assert.Nil(t, err)
+
+	// call ended without being answered
+	unanswered := *testCDR
+	unanswered.TransactionTag = "call-2"
+	unanswered.TimestampAnswer = ""
+	unanswered.Duration = 0
+	unanswered.Disposition = model.DispositionBusy
+	unanswered.SIPFinalCode = 486
+	unanswered.CaptureAgentID = 0
+	unanswered.CaptureAgentName = ""
+	unanswered.Quality = nil
+	err = client.Publish(ctx, rabbitmq.QueueNameCallDetailRecord, &unanswered)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "unknown", map[string]string{})
+	assert.EqualError(t, err, "unsupported request type for unknown: map[string]string")
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		CSVHeader,
+		{"begin_transaction", "default", "call-1", "1000", "", "sip:1000@example.com", "sip:2000@example.com",
+			"VOICE", "tag1|tag2", "2020-03-14T08:56:08Z", "", ""},
+		{"end_transaction", "default", "call-1", "1000", "", "", "", "", "", "", "2020-03-14T08:57:10Z", ""},
+	}, records)
+
+	// the call detail records have their own file and columns
+	f, err = os.Open(CDRPath(path))
+	assert.Nil(t, err)
+	defer f.Close()
+	records, err = csv.NewReader(f).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		CSVHeaderCDR,
+		{"default", "call-1", "1000", "", "sip:1000@example.com", "sip:2000@example.com",
+			"10.0.0.2", "10.0.0.1", "2001", "edge-proxy", "", "VOICE", "tag1|tag2",
+			"2020-03-14T08:56:05Z", "2020-03-14T08:56:08Z", "2020-03-14T08:57:10Z", "62",
+			"answered", "200", "12.5", "0.5", "4.3", "4.2"},
+		{"default", "call-2", "1000", "", "sip:1000@example.com", "sip:2000@example.com",
+			"10.0.0.2", "10.0.0.1", "", "", "", "VOICE", "tag1|tag2",
+			"2020-03-14T08:56:05Z", "", "2020-03-14T08:57:10Z", "0",
+			"busy", "486", "", "", "", ""},
+	}, records)
+
+	// the header is not written again when appending to the file
+	client = NewClient(Options{
+		Path:   path,
+		Format: FormatCSV,
+	})
+	err = client.Connect(ctx)
+	assert.Nil(t, err)
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	f, err = os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	records, err = csv.NewReader(f).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+}
+
+func TestClientRotation(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cdr.jsonl")
+
+	client := NewClient(Options{
+		Path:     path,
+		MaxSize:  400,
+		MaxAge:   time.Hour,
+		Compress: true,
+	})
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	client.file.now = func() time.Time {
+		return now
+	}
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	// the second begin transaction exceeds the maximum size
+	for i := 0; i < 2; i++ {
+		err = client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, testBegin)
+		assert.Nil(t, err)
+	}
+
+	// the end transaction exceeds the maximum age
+	now = now.Add(time.Hour)
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Nil(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "cdr-20200314T085608.jsonl.gz"),
+		filepath.Join(dir, "cdr-20200314T095608.jsonl.gz"),
+		filepath.Join(dir, "cdr.jsonl"),
+	}, files)
+
+	for i, expected := range []string{rabbitmq.QueueNameBeginTransaction, rabbitmq.QueueNameBeginTransaction} {
+		f, err := os.Open(files[i])
+		assert.Nil(t, err)
+		gz, err := gzip.NewReader(f)
+		assert.Nil(t, err)
+		data, err := ioutil.ReadAll(gz)
+		assert.Nil(t, err)
+		f.Close()
+		assert.Equal(t, 1, strings.Count(string(data), "\n"))
+		assert.Contains(t, string(data), expected)
+	}
+
+	data, err := ioutil.ReadFile(files[2])
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), rabbitmq.QueueNameEndTransaction)
+}
+
+func TestClientConnectFailed(t *testing.T) {
+	client := NewClient(Options{
+		Path: filepath.Join("non-existing", "cdr.jsonl"),
+	})
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+// rotatingFile is a file rotated when it exceeds the maximum size or age; the rotated
+// files are renamed adding the rotation time before the extension and, optionally,
+// compressed with gzip in background
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	compress bool
+	header   []byte
+	file     *os.File
+	size     int64
+	opened   time.Time
+	now      func() time.Time
+	wg       sync.WaitGroup
+}
+
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, compress bool) *rotatingFile {
+	return &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		compress: compress,
+		now:      time.Now,
+	}
+}
+
+// open opens the file, appending to the existing one; the header is written at
+// the beginning of each new file
+func (r *rotatingFile) open(header []byte) error {
+	r.header = header
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to open the file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to open the file")
+	}
+	r.file = f
+	r.size = info.Size()
+	r.opened = r.now()
+	if r.size == 0 && len(r.header) > 0 {
+		return r.write(r.header)
+	}
+	return nil
+}
+
+// Write writes the data, rotating the file before if needed
+func (r *rotatingFile) Write(data []byte) (int, error) {
+	if r.file == nil {
+		return 0, errors.New("not connected")
+	}
+	if r.size > int64(len(r.header)) && r.shouldRotate(len(data)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if err := r.write(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (r *rotatingFile) write(data []byte) error {
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "unable to write the file")
+	}
+	return nil
+}
+
+func (r *rotatingFile) shouldRotate(length int) bool {
+	if r.maxSize > 0 && r.size+int64(length) > r.maxSize {
+		return true
+	}
+	if r.maxAge > 0 && r.now().Sub(r.opened) >= r.maxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes and renames the current file, then opens a new one
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return errors.Wrap(err, "unable to close the file")
+	}
+	r.file = nil
+
+	rotated := r.rotatedPath()
+	if err := os.Rename(r.path, rotated); err != nil {
+		return errors.Wrap(err, "unable to rotate the file")
+	}
+	if r.compress {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			if err := compressFile(rotated); err != nil {
+				log.FromContext(context.Background()).Error(err)
+			}
+		}()
+	}
+	return r.open(r.header)
+}
+
+// rotatedPath returns the path of the rotated file, e.g. cdr-20200314T085609.jsonl
+func (r *rotatingFile) rotatedPath() string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext) + "-" + r.now().UTC().Format("20060102T150405")
+	rotated := base + ext
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return rotated
+}
+
+// Close closes the file and waits for the compression of the rotated files
+func (r *rotatingFile) Close() error {
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.wg.Wait()
+	if err != nil {
+		return errors.Wrap(err, "unable to close the file")
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// compressFile compresses a file with gzip, removing the original one
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to compress the rotated file")
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to compress the rotated file")
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return errors.Wrap(err, "unable to compress the rotated file")
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,157 @@
+package jetstream
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Client-specific constants
+const (
+	ClientName      = "rating-agent-hep"
+	DuplicateWindow = 10 * time.Minute
+	PublishTimeout  = 5 * time.Second
+)
+
+// publisher is the subset of the JetStream context used by the client
+type publisher interface {
+	PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error)
+}
+
+// Client is the NATS JetStream client object
+type Client struct {
+	conn          *nats.Conn
+	js            publisher
+	url           string
+	stream        string
+	subjectPrefix string
+	codec         codec.Codec
+}
+
+// NewClient initializes a new NATS JetStream client, publishing the messages to the
+// subjects <prefix>.<tenant>.<routing key> of the given stream
+func NewClient(url, stream, subjectPrefix string) *Client {
+	return &Client{
+		url:           url,
+		stream:        stream,
+		subjectPrefix: subjectPrefix,
+		codec:         codec.JSON,
+	}
+}
+
+// SetCodec sets the codec of the published messages, JSON by default
+func (c *Client) SetCodec(codec codec.Codec) {
+	c.codec = codec
+}
+
+// Connect connects the client to the NATS server, creating the stream if it does not exist
+func (c *Client) Connect(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	l.Debugf("Connecting to NATS: %s", c.url)
+	conn, err := nats.Connect(c.url, nats.Name(ClientName), nats.MaxReconnects(-1))
+	if err != nil {
+		return errors.Wrap(err, "unable to connect to the message bus")
+	}
+
+	js, err := conn.JetStream(nats.MaxWait(PublishTimeout))
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "unable to create the JetStream context")
+	}
+
+	if _, err := js.StreamInfo(c.stream); err != nil {
+		l.Debugf("Creating the JetStream stream: %s", c.stream)
+		if _, err := js.AddStream(&nats.StreamConfig{
+			Name:       c.stream,
+			Subjects:   []string{c.subjectPrefix + ".>"},
+			Duplicates: DuplicateWindow,
+		}); err != nil {
+			conn.Close()
+			return errors.Wrapf(err, "unable to create the stream: %s", c.stream)
+		}
+	}
+
+	c.conn = conn
+	c.js = js
+	return nil
+}
+
+// Close closes the client to the NATS server
+func (c *Client) Close(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	if err := c.conn.Drain(); err != nil {
+		return errors.Wrap(err, "unable to disconnect to the message bus")
+	}
+	c.conn = nil
+	c.js = nil
+	return nil
+}
+
+// Ping checks the client is connected to the NATS server
+func (c *Client) Ping(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	if !c.conn.IsConnected() {
+		return errors.New("the connection to the message bus is not established")
+	}
+	return nil
+}
+
+// Publish publishes a message to the subject of the tenant and routing key; the message
+// ID, made of transaction tag and routing key, lets JetStream discard the duplicates
+// published again after a reconnection
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	if c.js == nil {
+		return errors.New("not connected")
+	}
+
+	event, ok := req.(model.Event)
+	if !ok {
+		return errors.Errorf("unsupported request type: %T", req)
+	}
+
+	body, err := c.codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(Subject(c.subjectPrefix, event.GetTenant(), routingKey))
+	msg.Data = body
+	msg.Header.Set("Content-Type", c.codec.ContentType())
+	msg.Header.Set(nats.MsgIdHdr, model.MessageID(event, routingKey))
+
+	if _, err := c.js.PublishMsg(msg); err != nil {
+		return errors.Wrap(err, "unable to publish the request to the message bus")
+	}
+	return nil
+}
+
+// Subject returns the subject of the messages of a tenant and routing key
+func Subject(prefix, tenant, routingKey string) string {
+	return prefix + "." + subjectToken(tenant) + "." + subjectToken(routingKey)
+}
+
+// subjectToken replaces the characters which are not allowed in a subject token
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,115 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// fakeJetStream records the messages published, as stand-in for the JetStream context;
+// like JetStream, it discards the messages with an already seen message ID
+type fakeJetStream struct {
+	messages []*nats.Msg
+	seen     map[string]bool
+	err      error
+}
+
+func (p *fakeJetStream) PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	msgID := m.Header.Get(nats.MsgIdHdr)
+	if p.seen[msgID] {
+		return &nats.PubAck{Duplicate: true}, nil
+	}
+	p.seen[msgID] = true
+	p.messages = append(p.messages, m)
+	return &nats.PubAck{Sequence: uint64(len(p.messages))}, nil
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "rating.default.begin_transaction", Subject("rating", "default", rabbitmq.QueueNameBeginTransaction))
+	assert.Equal(t, "rating.acme_inc.end_transaction", Subject("rating", "acme.inc", rabbitmq.QueueNameEndTransaction))
+	assert.Equal(t, "rating._.end_transaction", Subject("rating", "", rabbitmq.QueueNameEndTransaction))
+	assert.Equal(t, "rating.a__b.end_transaction", Subject("rating", "a*>b", rabbitmq.QueueNameEndTransaction))
+}
+
+func TestClientPublish(t *testing.T) {
+	p := &fakeJetStream{seen: map[string]bool{}}
+	client := NewClient("nats://localhost:4222", "RATING", "rating")
+	client.js = p
+
+	ctx := context.Background()
+	begin := &model.BeginTransaction{
+		Request: model.BeginTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+		},
+	}
+	end := &model.EndTransaction{
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+		},
+	}
+
+	err := client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, begin)
+	assert.Nil(t, err)
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, end)
+	assert.Nil(t, err)
+
+	// published again, e.g. after a reconnection
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, end)
+	assert.Nil(t, err)
+
+	if assert.Len(t, p.messages, 2) {
+		assert.Equal(t, "rating.default.begin_transaction", p.messages[0].Subject)
+		assert.Equal(t, "call-1:begin_transaction", p.messages[0].Header.Get(nats.MsgIdHdr))
+		assert.Equal(t, "application/json", p.messages[0].Header.Get("Content-Type"))
+
+		published := &model.BeginTransaction{}
+		err = json.Unmarshal(p.messages[0].Data, published)
+		assert.Nil(t, err)
+		assert.Equal(t, begin, published)
+
+		assert.Equal(t, "rating.default.end_transaction", p.messages[1].Subject)
+		assert.Equal(t, "call-1:end_transaction", p.messages[1].Header.Get(nats.MsgIdHdr))
+	}
+
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, "unknown")
+	assert.EqualError(t, err, "unsupported request type: string")
+}
+
+func TestClientPublishFailure(t *testing.T) {
+	client := NewClient("nats://localhost:4222", "RATING", "rating")
+	client.js = &fakeJetStream{err: errors.New("nats: timeout")}
+
+	err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, &model.EndTransaction{})
+	assert.EqualError(t, err, "unable to publish the request to the message bus: nats: timeout")
+}
+
+func TestClientConnectFailed(t *testing.T) {
+	client := NewClient("nats://localhost:1", "RATING", "rating")
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Ping(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, &model.EndTransaction{})
+	assert.NotNil(t, err)
+
+	err = client.Close(ctx)
+	assert.NotNil(t, err)
+}
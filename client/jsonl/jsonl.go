@@ -0,0 +1,64 @@
+package jsonl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Client is a client which writes the published messages to a writer as JSON lines,
+// useful for dry runs
+type Client struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// Line is a line written by the client
+type Line struct {
+	RoutingKey string      `json:"routing_key"`
+	Request    interface{} `json:"request"`
+}
+
+// NewClient initializes a new JSON lines client
+func NewClient(writer io.Writer) *Client {
+	return &Client{
+		writer: writer,
+	}
+}
+
+// Connect connects the client
+func (c *Client) Connect(ctx context.Context) error {
+	return nil
+}
+
+// Close closes the client
+func (c *Client) Close(ctx context.Context) error {
+	return nil
+}
+
+// Ping checks the client is connected
+func (c *Client) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Publish writes a message as a JSON line
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	body, err := json.Marshal(&Line{
+		RoutingKey: routingKey,
+		Request:    req,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal request to JSON")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, err := c.writer.Write(append(body, '\n')); err != nil {
+		return errors.Wrap(err, "unable to write the request")
+	}
+	return nil
+}
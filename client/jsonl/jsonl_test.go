@@ -0,0 +1,38 @@
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	buf := &bytes.Buffer{}
+	client := NewClient(buf)
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "begin_transaction", map[string]string{"key": "value"})
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "end_transaction", nil)
+	assert.Nil(t, err)
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	expected := "{\"routing_key\":\"begin_transaction\",\"request\":{\"key\":\"value\"}}\n" +
+		"{\"routing_key\":\"end_transaction\",\"request\":null}\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestClientPublishError(t *testing.T) {
+	client := NewClient(&bytes.Buffer{})
+
+	err := client.Publish(context.Background(), "begin_transaction", make(chan int))
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Client-specific constants
+const (
+	ClientID          = "rating-agent-hep"
+	ProducerRetries   = 10
+	HeaderContentType = "content-type"
+)
+
+// Client is the Kafka client object
+type Client struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+	brokers  []string
+	topics   map[string]string
+	codec    codec.Codec
+}
+
+// NewClient initializes a new Kafka client, publishing the messages of each routing
+// key to the corresponding topic
+func NewClient(brokers []string, topics map[string]string) *Client {
+	return &Client{
+		brokers: brokers,
+		topics:  topics,
+		codec:   codec.JSON,
+	}
+}
+
+// SetCodec sets the codec of the published messages, JSON by default
+func (c *Client) SetCodec(codec codec.Codec) {
+	c.codec = codec
+}
+
+// newConfig returns the producer configuration: the producer is idempotent and waits
+// for all the in-sync replicas to acknowledge each message
+func newConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.ClientID = ClientID
+	config.Version = sarama.V2_0_0_0
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = ProducerRetries
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Net.MaxOpenRequests = 1
+	return config
+}
+
+// Connect connects the client to the Kafka brokers
+func (c *Client) Connect(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	l.Debugf("Connecting to the Kafka brokers: %v", c.brokers)
+	client, err := sarama.NewClient(c.brokers, newConfig())
+	if err != nil {
+		return errors.Wrap(err, "unable to connect to the message bus")
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return errors.Wrap(err, "unable to create the producer")
+	}
+	c.client = client
+	c.producer = producer
+	return nil
+}
+
+// Close closes the client to the Kafka brokers
+func (c *Client) Close(ctx context.Context) error {
+	if c.producer == nil {
+		return errors.New("not connected")
+	}
+	if err := c.producer.Close(); err != nil {
+		return errors.Wrap(err, "unable to close the producer")
+	}
+	if c.client != nil && !c.client.Closed() {
+		if err := c.client.Close(); err != nil {
+			return errors.Wrap(err, "unable to disconnect to the message bus")
+		}
+	}
+	c.producer = nil
+	return nil
+}
+
+// Ping checks the client can retrieve the metadata from the Kafka brokers
+func (c *Client) Ping(ctx context.Context) error {
+	if c.producer == nil {
+		return errors.New("not connected")
+	}
+	if c.client == nil {
+		return nil
+	}
+	if c.client.Closed() {
+		return errors.New("the connection to the message bus is closed")
+	}
+	if err := c.client.RefreshMetadata(); err != nil {
+		return errors.Wrap(err, "unable to retrieve the metadata from the message bus")
+	}
+	return nil
+}
+
+// Publish publishes a message to the topic of the routing key, using the Call-ID as
+// message key so that the messages of the same call land in the same partition
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	if c.producer == nil {
+		return errors.New("not connected")
+	}
+
+	topic, ok := c.topics[routingKey]
+	if !ok {
+		return errors.Errorf("no topic configured for %s", routingKey)
+	}
+
+	body, err := c.codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(body),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(HeaderContentType), Value: []byte(c.codec.ContentType())},
+		},
+	}
+	if event, ok := req.(model.Event); ok {
+		msg.Key = sarama.StringEncoder(event.GetTransactionTag())
+	}
+
+	if _, _, err := c.producer.SendMessage(msg); err != nil {
+		return errors.Wrap(err, "unable to publish the request to the message bus")
+	}
+	return nil
+}
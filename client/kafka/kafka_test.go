@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+var testTopics = map[string]string{
+	rabbitmq.QueueNameBeginTransaction: "billing.begin",
+	rabbitmq.QueueNameEndTransaction:   "billing.end",
+}
+
+func newMockBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("billing.begin", 0, broker.BrokerID()).
+			SetLeader("billing.end", 0, broker.BrokerID()),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+			ProducerID:    1,
+			ProducerEpoch: 0,
+		}),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetVersion(3).
+			SetError("billing.begin", 0, sarama.ErrNoError).
+			SetError("billing.end", 0, sarama.ErrNoError),
+	})
+	return broker
+}
+
+func TestNewConfig(t *testing.T) {
+	config := newConfig()
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Nil(t, config.Validate())
+}
+
+func TestClient(t *testing.T) {
+	broker := newMockBroker(t)
+	defer broker.Close()
+
+	ctx := context.Background()
+	client := NewClient([]string{broker.Addr()}, testTopics)
+
+	err := client.Connect(ctx)
+	assert.Nil(t, err)
+
+	err = client.Ping(ctx)
+	assert.Nil(t, err)
+
+	req := &model.BeginTransaction{
+		Request: model.BeginTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+		},
+	}
+	err = client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, req)
+	assert.Nil(t, err)
+
+	requests := map[string]bool{}
+	for _, rr := range broker.History() {
+		switch r := rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			requests["InitProducerIDRequest"] = true
+		case *sarama.ProduceRequest:
+			requests["ProduceRequest"] = true
+			assert.Equal(t, sarama.WaitForAll, r.RequiredAcks)
+		}
+	}
+	assert.True(t, requests["InitProducerIDRequest"])
+	assert.True(t, requests["ProduceRequest"])
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	err = client.Ping(ctx)
+	assert.NotNil(t, err)
+}
+
+func TestClientConnectFailed(t *testing.T) {
+	client := NewClient([]string{"localhost:1"}, testTopics)
+
+	ctx := context.Background()
+	err := client.Connect(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Ping(ctx)
+	assert.NotNil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, &model.BeginTransaction{})
+	assert.NotNil(t, err)
+
+	err = client.Close(ctx)
+	assert.NotNil(t, err)
+}
+
+// producer records the messages sent, as stand-in for the Kafka producer
+type producer struct {
+	sarama.SyncProducer
+	messages []*sarama.ProducerMessage
+}
+
+func (p *producer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.messages = append(p.messages, msg)
+	return 0, int64(len(p.messages)), nil
+}
+
+func TestClientPublish(t *testing.T) {
+	p := &producer{}
+	client := NewClient(nil, testTopics)
+	client.producer = p
+
+	ctx := context.Background()
+	begin := &model.BeginTransaction{
+		Request: model.BeginTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+		},
+	}
+	err := client.Publish(ctx, rabbitmq.QueueNameBeginTransaction, begin)
+	assert.Nil(t, err)
+
+	end := &model.EndTransaction{
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+		},
+	}
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, end)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "unknown", end)
+	assert.EqualError(t, err, "no topic configured for unknown")
+
+	if assert.Len(t, p.messages, 2) {
+		assert.Equal(t, "billing.begin", p.messages[0].Topic)
+		assert.Equal(t, sarama.StringEncoder("call-1"), p.messages[0].Key)
+		published := &model.BeginTransaction{}
+		err = json.Unmarshal(p.messages[0].Value.(sarama.ByteEncoder), published)
+		assert.Nil(t, err)
+		assert.Equal(t, begin, published)
+
+		assert.Equal(t, "billing.end", p.messages[1].Topic)
+		assert.Equal(t, sarama.StringEncoder("call-1"), p.messages[1].Key)
+	}
+}
+
+func TestClientPublishFailure(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	p.ExpectSendMessageAndFail(errors.New("broker not available"))
+
+	client := NewClient(nil, testTopics)
+	client.producer = p
+
+	err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, &model.EndTransaction{})
+	assert.EqualError(t, err, "unable to publish the request to the message bus: broker not available")
+
+	err = client.Close(context.Background())
+	assert.Nil(t, err)
+}
@@ -37,6 +37,19 @@ func (c *Client) Close(ctx context.Context) error {
 	return r0
 }
 
+// Ping checks the client is connected to the message bus
+func (c *Client) Ping(ctx context.Context) error {
+	ret := c.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
 // Publish publishes a message in the message bus
 func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
 	ret := c.Called(ctx, routingKey, req)
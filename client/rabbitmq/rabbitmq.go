@@ -2,11 +2,14 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
+
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
 )
 
 // Client-specific constants
@@ -14,12 +17,15 @@ const (
 	ExchangeName              = ""
 	QueueNameBeginTransaction = "begin_transaction"
 	QueueNameEndTransaction   = "end_transaction"
+	QueueNameCallDetailRecord = "call_detail_record"
+	HeaderSchemaVersion       = "schema_version"
 )
 
 // ClientInterface is the interface for RabbitMQ client objects
 type ClientInterface interface {
 	Connect(ctx context.Context) error
 	Close(ctx context.Context) error
+	Ping(ctx context.Context) error
 	Publish(ctx context.Context, routingKey string, req interface{}) error
 }
 
@@ -27,16 +33,40 @@ type ClientInterface interface {
 type Client struct {
 	connection    *amqp.Connection
 	channel       *amqp.Channel
+	channelClosed chan *amqp.Error
 	messageBusURI string
+	codec         codec.Codec
+	publishCDRs   bool
 }
 
 // NewClient initializes a new HEP processor
 func NewClient(messageBusURI string) *Client {
 	return &Client{
 		messageBusURI: messageBusURI,
+		codec:         codec.JSON,
 	}
 }
 
+// SetCodec sets the codec of the published messages, JSON by default
+func (c *Client) SetCodec(codec codec.Codec) {
+	c.codec = codec
+}
+
+// SetPublishCDRs sets whether the call detail records are published, declaring their
+// queue on connection
+func (c *Client) SetPublishCDRs(publishCDRs bool) {
+	c.publishCDRs = publishCDRs
+}
+
+// queues returns the names of the queues declared on connection
+func (c *Client) queues() []string {
+	queues := []string{QueueNameBeginTransaction, QueueNameEndTransaction}
+	if c.publishCDRs {
+		queues = append(queues, QueueNameCallDetailRecord)
+	}
+	return queues
+}
+
 // Connect connects the client to the message bus
 func (c *Client) Connect(ctx context.Context) error {
 	l := log.FromContext(ctx)
@@ -54,8 +84,9 @@ func (c *Client) Connect(ctx context.Context) error {
 		return errors.Wrap(err, "unable to create the channel")
 	}
 	c.channel = channel
+	c.channelClosed = channel.NotifyClose(make(chan *amqp.Error, 1))
 
-	for _, queue := range []string{QueueNameBeginTransaction, QueueNameEndTransaction} {
+	for _, queue := range c.queues() {
 		l.Debugf("Declaring the message bus queue: %s", queue)
 		if _, err := channel.QueueDeclare(
 			queue, // name
@@ -84,23 +115,60 @@ func (c *Client) Close(ctx context.Context) error {
 	return nil
 }
 
+// Ping checks the connection and the channel to the message bus are open
+func (c *Client) Ping(ctx context.Context) error {
+	if c.connection == nil || c.channel == nil {
+		return errors.New("not connected")
+	}
+	if c.connection.IsClosed() {
+		return errors.New("the connection to the message bus is closed")
+	}
+	select {
+	case <-c.channelClosed:
+		return errors.New("the channel is closed")
+	default:
+	}
+	return nil
+}
+
 // Publish publishes a message in the message bus
 func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
-	body, err := json.Marshal(req)
+	msg, err := newPublishing(c.codec, routingKey, req, time.Now())
 	if err != nil {
-		return errors.Wrap(err, "unable to marshal request to JSON")
+		return err
 	}
 	err = c.channel.Publish(
 		ExchangeName, // exchange
 		routingKey,   // routing key
 		false,        // mandatory
 		false,        // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        []byte(body),
-		})
+		msg,
+	)
 	if err != nil {
 		return errors.Wrap(err, "unable to publish the request to the message bus")
 	}
 	return nil
 }
+
+// newPublishing returns the AMQP message of a request; the events carry their type,
+// schema version, message ID and correlation ID (the Call-ID) in the properties
+func newPublishing(codec codec.Codec, routingKey string, req interface{}, timestamp time.Time) (amqp.Publishing, error) {
+	body, err := codec.Marshal(req)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	msg := amqp.Publishing{
+		ContentType: codec.ContentType(),
+		Type:        routingKey,
+		Timestamp:   timestamp.UTC(),
+		Body:        body,
+	}
+	if event, ok := req.(model.Event); ok {
+		msg.MessageId = model.MessageID(event, routingKey)
+		msg.CorrelationId = event.GetTransactionTag()
+		msg.Headers = amqp.Table{
+			HeaderSchemaVersion: event.GetSchemaVersion(),
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,83 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/model/pb"
+)
+
+func TestClientQueues(t *testing.T) {
+	client := NewClient("amqp://localhost:5672//")
+	assert.Equal(t, []string{QueueNameBeginTransaction, QueueNameEndTransaction}, client.queues())
+
+	client.SetPublishCDRs(true)
+	assert.Equal(t, []string{QueueNameBeginTransaction, QueueNameEndTransaction, QueueNameCallDetailRecord},
+		client.queues())
+}
+
+func TestNewPublishing(t *testing.T) {
+	timestamp := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	req := &model.EndTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			TimestampEnd:   "2020-03-14T08:56:08Z",
+		},
+	}
+
+	msg, err := newPublishing(codec.JSON, QueueNameEndTransaction, req, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", msg.ContentType)
+	assert.Equal(t, QueueNameEndTransaction, msg.Type)
+	assert.Equal(t, "call-1:end_transaction", msg.MessageId)
+	assert.Equal(t, "call-1", msg.CorrelationId)
+	assert.Equal(t, timestamp, msg.Timestamp)
+	assert.Equal(t, amqp.Table{HeaderSchemaVersion: "1.3"}, msg.Headers)
+	assert.Equal(t, `{"schema_version":"1.3","request":{"tenant":"default","transaction_tag":"call-1",`+
+		`"account_tag":"","destination_account_tag":"","timestamp_end":"2020-03-14T08:56:08Z"}}`, string(msg.Body))
+
+	msg, err = newPublishing(codec.JSON, "other", map[string]string{"key": "value"}, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "other", msg.Type)
+	assert.Empty(t, msg.MessageId)
+	assert.Nil(t, msg.Headers)
+
+	_, err = newPublishing(codec.JSON, "other", make(chan int), timestamp)
+	assert.NotNil(t, err)
+}
+
+func TestNewPublishingProtobuf(t *testing.T) {
+	timestamp := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	req := &model.EndTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			TimestampEnd:   "2020-03-14T08:56:08Z",
+		},
+	}
+
+	msg, err := newPublishing(codec.Protobuf, QueueNameEndTransaction, req, timestamp)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-protobuf", msg.ContentType)
+	assert.Equal(t, "call-1:end_transaction", msg.MessageId)
+	assert.Equal(t, amqp.Table{HeaderSchemaVersion: "1.3"}, msg.Headers)
+
+	event := &pb.EndTransaction{}
+	err = proto.Unmarshal(msg.Body, event)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3", event.SchemaVersion)
+	assert.Equal(t, "call-1", event.Request.TransactionTag)
+	assert.Equal(t, "2020-03-14T08:56:08Z", event.Request.TimestampEnd)
+
+	_, err = newPublishing(codec.Protobuf, "other", map[string]string{"key": "value"}, timestamp)
+	assert.EqualError(t, err, "unable to marshal request to Protocol Buffers: unsupported request type: map[string]string")
+}
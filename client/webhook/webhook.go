@@ -0,0 +1,280 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Client-specific constants
+const (
+	HeaderEvent     = "X-Rating-Agent-Event"
+	HeaderDelivery  = "X-Rating-Agent-Delivery"
+	HeaderSignature = "X-Rating-Agent-Signature"
+	SignaturePrefix = "sha256="
+	MaxRetryBackoff = time.Minute
+)
+
+// Options are the options of the webhook client
+type Options struct {
+	// URLs are the endpoints of each routing key
+	URLs map[string]string
+	// Secret is the key of the HMAC-SHA256 signature of the body, if set
+	Secret string
+	// Timeout is the timeout of each request
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first failed attempt
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled at each retry
+	RetryBackoff time.Duration
+	// Concurrency is the maximum number of concurrent requests
+	Concurrency int
+	// DeadLetterFile is the file where the requests which exhausted the retries are
+	// appended as JSON lines, if set
+	DeadLetterFile string
+	// Codec is the codec of the body, JSON if not set
+	Codec codec.Codec
+}
+
+// DeadLetter is a line of the dead-letter file; the request is stored as is if
+// encoded in JSON, base64 encoded in the body otherwise
+type DeadLetter struct {
+	RoutingKey string          `json:"routing_key"`
+	URL        string          `json:"url"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	Body       []byte          `json:"body,omitempty"`
+	Error      string          `json:"error"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// Client is the HTTP webhook client object
+type Client struct {
+	options    Options
+	httpClient *http.Client
+	semaphore  chan struct{}
+	// mutex guards the dead-letter file, the done channel and the additions to the
+	// requests in flight, so that no request starts once the client is closing
+	mutex      sync.Mutex
+	deadLetter *os.File
+	inFlight   sync.WaitGroup
+	done       chan struct{}
+}
+
+// NewClient initializes a new webhook client
+func NewClient(options Options) *Client {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.Codec == nil {
+		options.Codec = codec.JSON
+	}
+	return &Client{
+		options: options,
+		httpClient: &http.Client{
+			Timeout: options.Timeout,
+		},
+		semaphore: make(chan struct{}, options.Concurrency),
+	}
+}
+
+// Connect opens the dead-letter file
+func (c *Client) Connect(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.options.DeadLetterFile != "" {
+		f, err := os.OpenFile(c.options.DeadLetterFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return errors.Wrap(err, "unable to open the dead-letter file")
+		}
+		c.deadLetter = f
+	}
+	c.done = make(chan struct{})
+	return nil
+}
+
+// Close rejects the new requests, waits for the requests in flight, interrupting the
+// retries, and closes the dead-letter file
+func (c *Client) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.done == nil {
+		c.mutex.Unlock()
+		return errors.New("not connected")
+	}
+	close(c.done)
+	c.done = nil
+	c.mutex.Unlock()
+
+	c.inFlight.Wait()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.deadLetter != nil {
+		if err := c.deadLetter.Close(); err != nil {
+			return errors.Wrap(err, "unable to close the dead-letter file")
+		}
+		c.deadLetter = nil
+	}
+	return nil
+}
+
+// Ping checks the client is connected
+func (c *Client) Ping(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.done == nil {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// Publish posts a message to the URL of the routing key, retrying with exponential
+// backoff; the messages which exhaust the retries are written to the dead-letter file
+func (c *Client) Publish(ctx context.Context, routingKey string, req interface{}) error {
+	c.mutex.Lock()
+	done := c.done
+	if done == nil {
+		c.mutex.Unlock()
+		return errors.New("not connected")
+	}
+	c.inFlight.Add(1)
+	c.mutex.Unlock()
+	defer c.inFlight.Done()
+
+	url, ok := c.options.URLs[routingKey]
+	if !ok {
+		return errors.Errorf("no URL configured for %s", routingKey)
+	}
+
+	body, err := c.options.Codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	delivery := ""
+	if event, ok := req.(model.Event); ok {
+		delivery = model.MessageID(event, routingKey)
+	}
+
+	backoff := c.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(ctx, url, routingKey, delivery, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= c.options.MaxRetries {
+			c.writeDeadLetter(ctx, routingKey, url, body, err)
+			return errors.Wrap(err, "unable to publish the request to the webhook")
+		}
+
+		log.FromContext(ctx).WithFields(logrus.Fields{
+			"url":     url,
+			"attempt": attempt + 1,
+			"err":     err.Error(),
+		}).Warn("unable to publish the request to the webhook, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			c.writeDeadLetter(ctx, routingKey, url, body, ctx.Err())
+			return errors.Wrap(ctx.Err(), "unable to publish the request to the webhook")
+		case <-done:
+			c.writeDeadLetter(ctx, routingKey, url, body, err)
+			return errors.Wrap(err, "unable to publish the request to the webhook")
+		}
+		backoff *= 2
+		if backoff > MaxRetryBackoff {
+			backoff = MaxRetryBackoff
+		}
+	}
+}
+
+// post sends a request, holding a slot of the concurrency limit; it returns whether
+// the request can be retried in case of failure
+func (c *Client) post(ctx context.Context, url, routingKey, delivery string, body []byte) (bool, error) {
+	select {
+	case c.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	defer func() {
+		<-c.semaphore
+	}()
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "unable to create the request")
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", c.options.Codec.ContentType())
+	httpReq.Header.Set(HeaderEvent, routingKey)
+	if delivery != "" {
+		httpReq.Header.Set(HeaderDelivery, delivery)
+	}
+	if c.options.Secret != "" {
+		httpReq.Header.Set(HeaderSignature, Sign(c.options.Secret, body))
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = errors.Errorf("unexpected status code: %d", res.StatusCode)
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests ||
+		res.StatusCode == http.StatusRequestTimeout
+	return retry, err
+}
+
+func (c *Client) writeDeadLetter(ctx context.Context, routingKey, url string, body []byte, cause error) {
+	if c.options.DeadLetterFile == "" {
+		return
+	}
+
+	deadLetter := &DeadLetter{
+		RoutingKey: routingKey,
+		URL:        url,
+		Error:      cause.Error(),
+		Timestamp:  time.Now().UTC(),
+	}
+	if c.options.Codec.ContentType() == codec.ContentTypeJSON {
+		deadLetter.Request = body
+	} else {
+		deadLetter.Body = body
+	}
+	line, err := json.Marshal(deadLetter)
+	if err == nil {
+		c.mutex.Lock()
+		if c.deadLetter != nil {
+			_, err = c.deadLetter.Write(append(line, '\n'))
+		}
+		c.mutex.Unlock()
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(errors.Wrap(err, "unable to write the dead-letter file"))
+	}
+}
+
+// Sign returns the value of the signature header of a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
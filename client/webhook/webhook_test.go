@@ -0,0 +1,344 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/codec"
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/model/pb"
+)
+
+var testEnd = &model.EndTransaction{
+	Request: model.EndTransactionRequest{
+		Tenant:         "default",
+		TransactionTag: "call-1",
+		AccountTag:     "1000",
+		TimestampEnd:   "2020-03-14T08:56:09Z",
+	},
+}
+
+func newTestClient(t *testing.T, url string, options Options) *Client {
+	options.URLs = map[string]string{
+		rabbitmq.QueueNameBeginTransaction: url + "/begin",
+		rabbitmq.QueueNameEndTransaction:   url + "/end",
+	}
+	if options.Timeout == 0 {
+		options.Timeout = time.Second
+	}
+	client := NewClient(options)
+	err := client.Connect(context.Background())
+	assert.Nil(t, err)
+	return client
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestClientPublish(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/end", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, rabbitmq.QueueNameEndTransaction, r.Header.Get(HeaderEvent))
+		assert.Equal(t, "call-1:end_transaction", r.Header.Get(HeaderDelivery))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, Sign("secret", body), r.Header.Get(HeaderSignature))
+
+		published := &model.EndTransaction{}
+		err := json.Unmarshal(body, published)
+		assert.Nil(t, err)
+		assert.Equal(t, testEnd, published)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, Options{Secret: "secret"})
+
+	ctx := context.Background()
+	err := client.Ping(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, "unknown", testEnd)
+	assert.EqualError(t, err, "no URL configured for unknown")
+
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	err = client.Publish(ctx, rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestClientPublishRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.Header.Get(HeaderSignature))
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, Options{
+		MaxRetries:   3,
+		RetryBackoff: 10 * time.Millisecond,
+	})
+	defer client.Close(context.Background())
+
+	start := time.Now()
+	err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// 10ms + 20ms of exponential backoff
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+}
+
+func TestClientPublishDeadLetter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if r.URL.Path == "/begin" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	deadLetterFile := filepath.Join(dir, "dead-letter.jsonl")
+
+	client := newTestClient(t, server.URL, Options{
+		MaxRetries:     2,
+		RetryBackoff:   time.Millisecond,
+		DeadLetterFile: deadLetterFile,
+	})
+
+	err = client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.EqualError(t, err, "unable to publish the request to the webhook: unexpected status code: 500")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// client errors are not retried
+	err = client.Publish(context.Background(), rabbitmq.QueueNameBeginTransaction, &model.BeginTransaction{})
+	assert.EqualError(t, err, "unable to publish the request to the webhook: unexpected status code: 400")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&attempts))
+
+	err = client.Close(context.Background())
+	assert.Nil(t, err)
+
+	f, err := os.Open(deadLetterFile)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	deadLetters := []*DeadLetter{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		deadLetter := &DeadLetter{}
+		err := json.Unmarshal(scanner.Bytes(), deadLetter)
+		assert.Nil(t, err)
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	if assert.Len(t, deadLetters, 2) {
+		assert.Equal(t, rabbitmq.QueueNameEndTransaction, deadLetters[0].RoutingKey)
+		assert.Equal(t, server.URL+"/end", deadLetters[0].URL)
+		assert.Equal(t, "unexpected status code: 500", deadLetters[0].Error)
+
+		published := &model.EndTransaction{}
+		err = json.Unmarshal(deadLetters[0].Request, published)
+		assert.Nil(t, err)
+		assert.Equal(t, testEnd, published)
+
+		assert.Equal(t, rabbitmq.QueueNameBeginTransaction, deadLetters[1].RoutingKey)
+	}
+}
+
+func TestClientPublishProtobuf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		published := &pb.EndTransaction{}
+		err := proto.Unmarshal(body, published)
+		assert.Nil(t, err)
+		assert.Equal(t, "call-1", published.Request.TransactionTag)
+		assert.Equal(t, "1000", published.Request.AccountTag)
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	deadLetterFile := filepath.Join(dir, "dead-letter.jsonl")
+
+	client := newTestClient(t, server.URL, Options{
+		DeadLetterFile: deadLetterFile,
+		Codec:          codec.Protobuf,
+	})
+
+	err = client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.EqualError(t, err, "unable to publish the request to the webhook: unexpected status code: 503")
+
+	err = client.Close(context.Background())
+	assert.Nil(t, err)
+
+	// the body is not JSON, hence it is stored base64 encoded
+	data, err := ioutil.ReadFile(deadLetterFile)
+	assert.Nil(t, err)
+	deadLetter := &DeadLetter{}
+	err = json.Unmarshal(data, deadLetter)
+	assert.Nil(t, err)
+	assert.Empty(t, deadLetter.Request)
+
+	published := &pb.EndTransaction{}
+	err = proto.Unmarshal(deadLetter.Body, published)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", published.Request.TransactionTag)
+}
+
+func TestClientPublishTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, Options{
+		Timeout: 10 * time.Millisecond,
+	})
+	defer client.Close(context.Background())
+
+	err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.Error(t, err)
+}
+
+func TestClientPublishConcurrency(t *testing.T) {
+	var current, max int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, Options{
+		Concurrency: 2,
+	})
+	defer client.Close(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestClientCloseInterruptsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, Options{
+		MaxRetries:   10,
+		RetryBackoff: time.Hour,
+	})
+
+	errs := make(chan error)
+	go func() {
+		errs <- client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	err := client.Close(context.Background())
+	assert.Nil(t, err)
+	assert.Error(t, <-errs)
+}
+
+func TestClientPublishWhileClosing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	deadLetterFile := filepath.Join(dir, "dead-letter.jsonl")
+
+	client := newTestClient(t, server.URL, Options{
+		MaxRetries:     10,
+		RetryBackoff:   time.Hour,
+		Concurrency:    10,
+		DeadLetterFile: deadLetterFile,
+	})
+
+	// the requests either fail as the client is closed, or are written to the
+	// dead-letter file before it is closed
+	var rejected int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+			if err != nil && err.Error() == "not connected" {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	err = client.Close(context.Background())
+	assert.Nil(t, err)
+	wg.Wait()
+
+	err = client.Publish(context.Background(), rabbitmq.QueueNameEndTransaction, testEnd)
+	assert.EqualError(t, err, "not connected")
+	err = client.Ping(context.Background())
+	assert.EqualError(t, err, "not connected")
+
+	data, err := ioutil.ReadFile(deadLetterFile)
+	assert.Nil(t, err)
+	lines := bytes.Count(data, []byte("\n"))
+	assert.Equal(t, 20, lines+int(atomic.LoadInt32(&rejected)))
+}
@@ -0,0 +1,73 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/canyanio/rating-agent-hep/model/pb"
+)
+
+// Encodings and content types of the published messages
+const (
+	EncodingJSON        = "json"
+	EncodingProtobuf    = "protobuf"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec encodes the messages published to the message bus
+type Codec interface {
+	ContentType() string
+	Marshal(req interface{}) ([]byte, error)
+}
+
+// JSON and Protobuf are the supported codecs
+var (
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+// New returns the codec of an encoding
+func New(encoding string) (Codec, error) {
+	switch encoding {
+	case EncodingJSON, "":
+		return JSON, nil
+	case EncodingProtobuf:
+		return Protobuf, nil
+	}
+	return nil, errors.Errorf("unknown encoding: %s", encoding)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(req interface{}) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal request to JSON")
+	}
+	return body, nil
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protobufCodec) Marshal(req interface{}) ([]byte, error) {
+	msg, err := pb.FromModel(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal request to Protocol Buffers")
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal request to Protocol Buffers")
+	}
+	return body, nil
+}
@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/model/pb"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New(EncodingJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypeJSON, c.ContentType())
+
+	c, err = New(EncodingProtobuf)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypeProtobuf, c.ContentType())
+
+	_, err = New("xml")
+	assert.EqualError(t, err, "unknown encoding: xml")
+}
+
+func TestMarshalJSON(t *testing.T) {
+	body, err := JSON.Marshal(&model.EndTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.EndTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			TimestampEnd:   "2020-03-14T08:56:09Z",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"schema_version":"1.3","request":{"tenant":"default","transaction_tag":"call-1",`+
+		`"account_tag":"","destination_account_tag":"","timestamp_end":"2020-03-14T08:56:09Z"}}`, string(body))
+
+	_, err = JSON.Marshal(make(chan int))
+	assert.NotNil(t, err)
+}
+
+func TestMarshalProtobuf(t *testing.T) {
+	body, err := Protobuf.Marshal(&model.BeginTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.BeginTransactionRequest{
+			Tenant:                "default",
+			TransactionTag:        "call-1",
+			AccountTag:            "1000",
+			DestinationAccountTag: "1001",
+			Source:                "sip:1000@127.0.0.1",
+			Destination:           "sip:1001@127.0.0.1",
+			Tags:                  []string{"tag1"},
+			TimestampBegin:        "2020-03-14T08:56:08Z",
+		},
+	})
+	assert.Nil(t, err)
+
+	begin := &pb.BeginTransaction{}
+	err = proto.Unmarshal(body, begin)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3", begin.SchemaVersion)
+	assert.Equal(t, "call-1", begin.Request.TransactionTag)
+	assert.Equal(t, "1001", begin.Request.DestinationAccountTag)
+	assert.Equal(t, []string{"tag1"}, begin.Request.Tags)
+	assert.Equal(t, "2020-03-14T08:56:08Z", begin.Request.TimestampBegin)
+
+	body, err = Protobuf.Marshal(&model.CallDetailRecord{
+		SchemaVersion:   model.CallDetailRecordSchemaVersion,
+		TransactionTag:  "call-1",
+		SourceIP:        "192.168.192.2",
+		CaptureAgentID:  1,
+		TimestampInvite: "2020-03-14T08:56:08Z",
+		TimestampEnd:    "2020-03-14T08:56:09Z",
+		Duration:        1,
+		Disposition:     model.DispositionBusy,
+		SIPFinalCode:    486,
+	})
+	assert.Nil(t, err)
+
+	cdr := &pb.CallDetailRecord{}
+	err = proto.Unmarshal(body, cdr)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", cdr.TransactionTag)
+	assert.Equal(t, "192.168.192.2", cdr.SourceIp)
+	assert.Equal(t, uint32(1), cdr.CaptureAgentId)
+	assert.Equal(t, int64(1), cdr.Duration)
+	assert.Equal(t, model.DispositionBusy, cdr.Disposition)
+	assert.Equal(t, int32(486), cdr.SipFinalCode)
+
+	_, err = Protobuf.Marshal("request")
+	assert.EqualError(t, err, "unable to marshal request to Protocol Buffers: unsupported request type: string")
+}
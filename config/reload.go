@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+var configFile string
+
+// Reload re-reads the configuration file used by Init, including the environment
+// overrides, and returns the validated settings
+func Reload() (*Settings, error) {
+	c := viper.New()
+	config.SetDefaults(c, Defaults)
+	if configFile != "" {
+		c.SetConfigFile(configFile)
+		if err := c.ReadInConfig(); err != nil {
+			return nil, errors.Wrap(err, "error loading configuration file")
+		}
+	}
+	setupEnv(c)
+
+	return NewSettings(c)
+}
+
+// WithReloadable returns a copy of the settings where the extraction and tagging
+// settings, which can be changed at runtime, are replaced by the other ones
+func (s *Settings) WithReloadable(other *Settings) *Settings {
+	settings := *s
+	settings.SIP = other.SIP
+	settings.ProductTag = other.ProductTag
+	settings.TransactionTags = other.TransactionTags
+	return &settings
+}
+
+// Diff returns a human readable list of the extraction and tagging settings
+// which differ from the other settings
+func (s *Settings) Diff(other *Settings) []string {
+	fields := []struct {
+		key      string
+		old, new interface{}
+	}{
+		{SettingSIPHeaderCaller, s.SIP.HeaderCaller, other.SIP.HeaderCaller},
+		{SettingSIPHeaderCallee, s.SIP.HeaderCallee, other.SIP.HeaderCallee},
+		{SettingSIPHeaderHistoryInfo, s.SIP.HeaderHistoryInfo, other.SIP.HeaderHistoryInfo},
+		{SettingSIPHeaderHistoryInfoIndex, s.SIP.HeaderHistoryInfoIndex, other.SIP.HeaderHistoryInfoIndex},
+		{SettingSIPLocalDomains, s.SIP.LocalDomains, other.SIP.LocalDomains},
+		{SettingAccountTagMatchRegexp, s.SIP.AccountTagMatchRegexp, other.SIP.AccountTagMatchRegexp},
+		{SettingSIPAddresses, s.SIP.Addresses, other.SIP.Addresses},
+		{SettingBillingDirection, s.SIP.BillingDirection, other.SIP.BillingDirection},
+		{SettingCaptureAgents, s.SIP.CaptureAgents, other.SIP.CaptureAgents},
+		{SettingProductTag, s.ProductTag, other.ProductTag},
+		{SettingTransactionTags, s.TransactionTags, other.TransactionTags},
+	}
+	changes := []string{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field.key, field.old, field.new))
+		}
+	}
+	return changes
+}
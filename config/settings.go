@@ -0,0 +1,816 @@
+package config
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// Settings are the validated settings of the agent
+type Settings struct {
+	ListenUDP       string
+	ListenTCP       string
+	ListenSIPUDP    string
+	ListenHTTP      string
+	AdminToken      string
+	MessageBusType  string
+	MessageBusURI   string
+	PublishCDRs     bool
+	MessageEncoding string
+	Kafka           KafkaSettings
+	NATS            NATSSettings
+	Webhook         WebhookSettings
+	FileSink        FileSinkSettings
+	Sinks           SinksSettings
+	StateManager    string
+	Redis           RedisSettings
+	StateFile       StateFileSettings
+	Dedup           DedupSettings
+	Tenant          string
+	SIP             SIPSettings
+	ProductTag      string
+	TransactionTags []string
+	// captureAgentsErr is the error decoding the capture agents settings
+	captureAgentsErr error
+}
+
+// SIPSettings are the settings used to extract the accounts from the SIP messages
+type SIPSettings struct {
+	HeaderCaller           string
+	HeaderCallee           string
+	HeaderHistoryInfo      string
+	HeaderHistoryInfoIndex int
+	LocalDomains           []string
+	AccountTagMatchRegexp  string
+	// Addresses are the SIP addresses of the platform, which classify the messages
+	// as ingress, egress or internal
+	Addresses []string
+	// BillingDirection is the only direction of the calls rated, if not empty
+	BillingDirection string
+	CaptureAgents    []CaptureAgentSettings
+}
+
+// CaptureAgentSettings are the settings of a HEP capture agent, identified by its ID
+type CaptureAgentSettings struct {
+	ID   uint32
+	Name string
+	// LocalDomains replace the SIP local domains for the messages of the agent
+	LocalDomains []string
+	// Addresses are the SIP addresses of the agent, in addition to the ones of the
+	// platform
+	Addresses []string
+	// Direction replaces the billing direction for the calls reported by the agent
+	Direction string
+	// Billing is false if the messages of the agent are not trusted for billing
+	Billing bool
+}
+
+// captureAgentConfig is the configuration of a capture agent
+type captureAgentConfig struct {
+	ID           uint32   `mapstructure:"id"`
+	Name         string   `mapstructure:"name"`
+	LocalDomains []string `mapstructure:"local_domains"`
+	Addresses    []string `mapstructure:"addresses"`
+	Direction    string   `mapstructure:"direction"`
+	Billing      *bool    `mapstructure:"billing"`
+}
+
+// BillingDirectionFor returns the only direction of the calls rated for a capture
+// agent, empty if the calls are rated in any direction
+func (s *SIPSettings) BillingDirectionFor(id uint32) string {
+	if agent := s.CaptureAgent(id); agent != nil && agent.Direction != "" {
+		return agent.Direction
+	}
+	return s.BillingDirection
+}
+
+// AddressesFor returns the SIP addresses used to classify the messages of a capture agent
+func (s *SIPSettings) AddressesFor(id uint32) []string {
+	agent := s.CaptureAgent(id)
+	if agent == nil || len(agent.Addresses) == 0 {
+		return s.Addresses
+	}
+	return append(append([]string{}, s.Addresses...), agent.Addresses...)
+}
+
+// CaptureAgent returns the settings of a capture agent, nil if not configured
+func (s *SIPSettings) CaptureAgent(id uint32) *CaptureAgentSettings {
+	for i := range s.CaptureAgents {
+		if s.CaptureAgents[i].ID == id {
+			return &s.CaptureAgents[i]
+		}
+	}
+	return nil
+}
+
+// ForCaptureAgent returns the settings used for the messages of a capture agent
+func (s *SIPSettings) ForCaptureAgent(id uint32) *SIPSettings {
+	agent := s.CaptureAgent(id)
+	if agent == nil || agent.LocalDomains == nil {
+		return s
+	}
+	settings := *s
+	settings.LocalDomains = agent.LocalDomains
+	return &settings
+}
+
+// readCaptureAgents decodes the capture agents settings, a list of objects or its
+// JSON encoding when set with the environment variable
+func readCaptureAgents(c config.Reader) ([]CaptureAgentSettings, error) {
+	value := c.Get(SettingCaptureAgents)
+	if s, ok := value.(string); ok {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", SettingCaptureAgents)
+		}
+	}
+	var configs []captureAgentConfig
+	if err := mapstructure.WeakDecode(value, &configs); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", SettingCaptureAgents)
+	}
+	agents := make([]CaptureAgentSettings, len(configs))
+	for i, agent := range configs {
+		agents[i] = CaptureAgentSettings{
+			ID:           agent.ID,
+			Name:         agent.Name,
+			LocalDomains: agent.LocalDomains,
+			Addresses:    agent.Addresses,
+			Direction:    agent.Direction,
+			Billing:      agent.Billing == nil || *agent.Billing,
+		}
+	}
+	return agents, nil
+}
+
+// RedisSettings are the settings of the Redis state manager
+type RedisSettings struct {
+	Address               string
+	Username              string
+	Password              string
+	DB                    int
+	KeyPrefix             string
+	SentinelMasterName    string
+	SentinelAddresses     []string
+	SentinelPassword      string
+	ClusterAddresses      []string
+	TLS                   bool
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+	PoolSize              int
+	DialTimeout           time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	ConnectRetries        int
+	ConnectRetryBackoff   time.Duration
+}
+
+// StateFileSettings are the settings of the file state manager
+type StateFileSettings struct {
+	Directory string
+	Sync      bool
+}
+
+// DedupSettings are the settings of the duplicate messages suppression
+type DedupSettings struct {
+	Window time.Duration
+	Key    string
+}
+
+// KafkaSettings are the settings of the Kafka message bus
+type KafkaSettings struct {
+	Brokers               []string
+	TopicBeginTransaction string
+	TopicEndTransaction   string
+	TopicCallDetailRecord string
+}
+
+// NATSSettings are the settings of the NATS JetStream message bus
+type NATSSettings struct {
+	URL           string
+	Stream        string
+	SubjectPrefix string
+}
+
+// WebhookSettings are the settings of the HTTP webhook publisher
+type WebhookSettings struct {
+	URLBeginTransaction string
+	URLEndTransaction   string
+	URLCallDetailRecord string
+	Secret              string
+	Timeout             time.Duration
+	MaxRetries          int
+	RetryBackoff        time.Duration
+	Concurrency         int
+	DeadLetterFile      string
+}
+
+// FileSinkSettings are the settings of the file sink
+type FileSinkSettings struct {
+	Path     string
+	Format   string
+	MaxSize  int64
+	MaxAge   time.Duration
+	Compress bool
+}
+
+// SinksSettings are the settings of the additional sinks of the fan-out publisher
+type SinksSettings struct {
+	Names        []string
+	Mandatory    []string
+	QueueSize    int
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// NewSettings loads and validates the settings from the given configuration
+func NewSettings(c config.Reader) (*Settings, error) {
+	s := readSettings(c)
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func readSettings(c config.Reader) *Settings {
+	s := &Settings{
+		ListenUDP:       c.GetString(SettingListenUDP),
+		ListenTCP:       c.GetString(SettingListenTCP),
+		ListenSIPUDP:    c.GetString(SettingListenSIPUDP),
+		ListenHTTP:      c.GetString(SettingListenHTTP),
+		AdminToken:      c.GetString(SettingAdminToken),
+		MessageBusType:  c.GetString(SettingMessageBusType),
+		MessageBusURI:   c.GetString(SettingMessageBusURI),
+		PublishCDRs:     c.GetBool(SettingPublishCallDetailRecords),
+		MessageEncoding: c.GetString(SettingMessageEncoding),
+		Kafka: KafkaSettings{
+			Brokers:               c.GetStringSlice(SettingKafkaBrokers),
+			TopicBeginTransaction: c.GetString(SettingKafkaTopicBeginTransaction),
+			TopicEndTransaction:   c.GetString(SettingKafkaTopicEndTransaction),
+			TopicCallDetailRecord: c.GetString(SettingKafkaTopicCallDetailRecord),
+		},
+		NATS: NATSSettings{
+			URL:           c.GetString(SettingNATSURL),
+			Stream:        c.GetString(SettingNATSStream),
+			SubjectPrefix: c.GetString(SettingNATSSubjectPrefix),
+		},
+		Webhook: WebhookSettings{
+			URLBeginTransaction: c.GetString(SettingWebhookURLBeginTransaction),
+			URLEndTransaction:   c.GetString(SettingWebhookURLEndTransaction),
+			URLCallDetailRecord: c.GetString(SettingWebhookURLCallDetailRecord),
+			Secret:              c.GetString(SettingWebhookSecret),
+			Timeout:             c.GetDuration(SettingWebhookTimeout),
+			MaxRetries:          c.GetInt(SettingWebhookMaxRetries),
+			RetryBackoff:        c.GetDuration(SettingWebhookRetryBackoff),
+			Concurrency:         c.GetInt(SettingWebhookConcurrency),
+			DeadLetterFile:      c.GetString(SettingWebhookDeadLetterFile),
+		},
+		FileSink: FileSinkSettings{
+			Path:     c.GetString(SettingFileSinkPath),
+			Format:   c.GetString(SettingFileSinkFormat),
+			MaxSize:  int64(c.GetInt(SettingFileSinkMaxSize)),
+			MaxAge:   c.GetDuration(SettingFileSinkMaxAge),
+			Compress: c.GetBool(SettingFileSinkCompress),
+		},
+		Sinks: SinksSettings{
+			Names:        c.GetStringSlice(SettingMessageBusSinks),
+			Mandatory:    c.GetStringSlice(SettingMessageBusMandatorySinks),
+			QueueSize:    c.GetInt(SettingMessageBusSinkQueueSize),
+			MaxRetries:   c.GetInt(SettingMessageBusSinkMaxRetries),
+			RetryBackoff: c.GetDuration(SettingMessageBusSinkRetryBackoff),
+		},
+		StateManager: c.GetString(SettingStateManager),
+		Redis: RedisSettings{
+			Address:               c.GetString(SettingRedisAddress),
+			Username:              c.GetString(SettingRedisUsername),
+			Password:              c.GetString(SettingRedisPassword),
+			DB:                    c.GetInt(SettingRedisDb),
+			KeyPrefix:             c.GetString(SettingRedisKeyPrefix),
+			SentinelMasterName:    c.GetString(SettingRedisSentinelMasterName),
+			SentinelAddresses:     c.GetStringSlice(SettingRedisSentinelAddresses),
+			SentinelPassword:      c.GetString(SettingRedisSentinelPassword),
+			ClusterAddresses:      c.GetStringSlice(SettingRedisClusterAddresses),
+			TLS:                   c.GetBool(SettingRedisTLS),
+			TLSCAFile:             c.GetString(SettingRedisTLSCAFile),
+			TLSInsecureSkipVerify: c.GetBool(SettingRedisTLSInsecureSkipVerify),
+			PoolSize:              c.GetInt(SettingRedisPoolSize),
+			DialTimeout:           c.GetDuration(SettingRedisDialTimeout),
+			ReadTimeout:           c.GetDuration(SettingRedisReadTimeout),
+			WriteTimeout:          c.GetDuration(SettingRedisWriteTimeout),
+			ConnectRetries:        c.GetInt(SettingRedisConnectRetries),
+			ConnectRetryBackoff:   c.GetDuration(SettingRedisConnectRetryBackoff),
+		},
+		StateFile: StateFileSettings{
+			Directory: c.GetString(SettingStateFileDirectory),
+			Sync:      c.GetBool(SettingStateFileSync),
+		},
+		Dedup: DedupSettings{
+			Window: c.GetDuration(SettingDedupWindow),
+			Key:    c.GetString(SettingDedupKey),
+		},
+		Tenant: c.GetString(SettingTenant),
+		SIP: SIPSettings{
+			HeaderCaller:           c.GetString(SettingSIPHeaderCaller),
+			HeaderCallee:           c.GetString(SettingSIPHeaderCallee),
+			HeaderHistoryInfo:      c.GetString(SettingSIPHeaderHistoryInfo),
+			HeaderHistoryInfoIndex: c.GetInt(SettingSIPHeaderHistoryInfoIndex),
+			LocalDomains:           c.GetStringSlice(SettingSIPLocalDomains),
+			AccountTagMatchRegexp:  c.GetString(SettingAccountTagMatchRegexp),
+			Addresses:              c.GetStringSlice(SettingSIPAddresses),
+			BillingDirection:       c.GetString(SettingBillingDirection),
+		},
+		ProductTag:      c.GetString(SettingProductTag),
+		TransactionTags: c.GetStringSlice(SettingTransactionTags),
+	}
+	s.SIP.CaptureAgents, s.captureAgentsErr = readCaptureAgents(c)
+	return s
+}
+
+// Validate checks the settings, returning an error which lists all the invalid ones
+func (s *Settings) Validate() error {
+	errs := s.Check()
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// Check checks the settings and returns an error for each invalid one
+func (s *Settings) Check() []error {
+	errs := []error{}
+
+	if s.ListenUDP == "" && s.ListenTCP == "" && s.ListenSIPUDP == "" {
+		errs = append(errs, errors.Errorf("neither %s, %s nor %s are set", SettingListenUDP, SettingListenTCP,
+			SettingListenSIPUDP))
+	}
+	for _, listen := range []struct{ key, value string }{
+		{SettingListenUDP, s.ListenUDP},
+		{SettingListenTCP, s.ListenTCP},
+		{SettingListenSIPUDP, s.ListenSIPUDP},
+		{SettingListenHTTP, s.ListenHTTP},
+	} {
+		if listen.value == "" {
+			continue
+		}
+		if err := checkAddress(listen.value); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", listen.key))
+		}
+	}
+
+	if s.MessageEncoding != MessageEncodingJSON && s.MessageEncoding != MessageEncodingProtobuf {
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingMessageEncoding, s.MessageEncoding))
+	}
+	errs = append(errs, s.checkMessageBus(s.MessageBusType)...)
+	errs = append(errs, s.checkSinks()...)
+
+	if s.FileSink.Format != FileSinkFormatJSONL && s.FileSink.Format != FileSinkFormatCSV {
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingFileSinkFormat, s.FileSink.Format))
+	}
+	if s.FileSink.MaxSize < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingFileSinkMaxSize))
+	}
+	if s.FileSink.MaxAge < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingFileSinkMaxAge))
+	}
+
+	switch s.StateManager {
+	case StateManagerMemory:
+	case StateManagerRedis:
+		errs = append(errs, s.checkRedis()...)
+	case StateManagerFile:
+		if s.StateFile.Directory == "" {
+			errs = append(errs, errors.Errorf("invalid %s: must not be empty", SettingStateFileDirectory))
+		}
+	default:
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingStateManager, s.StateManager))
+	}
+
+	if s.Dedup.Window < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingDedupWindow))
+	}
+	if s.Dedup.Key != DedupKeyPayload && s.Dedup.Key != DedupKeyTransaction {
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingDedupKey, s.Dedup.Key))
+	}
+
+	errs = append(errs, s.checkTenant()...)
+
+	if s.SIP.HeaderHistoryInfo != "" {
+		if _, err := regexp.Compile(s.SIP.HeaderHistoryInfo + ":\\s*<sip:(.+)@"); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingSIPHeaderHistoryInfo))
+		}
+	}
+	if s.SIP.HeaderHistoryInfoIndex < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingSIPHeaderHistoryInfoIndex))
+	}
+	for _, domain := range s.SIP.LocalDomains {
+		if domain == "" {
+			errs = append(errs, errors.Errorf("invalid %s: empty domain", SettingSIPLocalDomains))
+			break
+		}
+	}
+	errs = append(errs, s.checkDirection()...)
+	errs = append(errs, s.checkCaptureAgents()...)
+	if s.SIP.AccountTagMatchRegexp != "" {
+		if r, err := regexp.Compile(s.SIP.AccountTagMatchRegexp); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingAccountTagMatchRegexp))
+		} else if r.NumSubexp() < 1 {
+			errs = append(errs, errors.Errorf("invalid %s: a capturing group is required", SettingAccountTagMatchRegexp))
+		}
+	}
+
+	return errs
+}
+
+// checkTenant checks that the tenant maps to a distinct name in the message buses and
+// state managers which include it: a NATS subject token and a Redis key namespace,
+// the namespaces starting with an underscore being reserved to the agent
+func (s *Settings) checkTenant() []error {
+	if s.Tenant == "" {
+		return []error{errors.Errorf("invalid %s: must not be empty", SettingTenant)}
+	}
+	errs := []error{}
+	nats := s.MessageBusType == MessageBusTypeNATS
+	for _, sink := range s.Sinks.Names {
+		nats = nats || sink == MessageBusTypeNATS
+	}
+	if nats && strings.ContainsAny(s.Tenant, ".*> \t\r\n") {
+		errs = append(errs, errors.Errorf("invalid %s: %q is not a valid NATS subject token", SettingTenant, s.Tenant))
+	}
+	if s.StateManager == StateManagerRedis && strings.Contains(s.Tenant, ":") {
+		errs = append(errs, errors.Errorf("invalid %s: %q must not contain ':' with the Redis state manager",
+			SettingTenant, s.Tenant))
+	}
+	if s.StateManager == StateManagerRedis && strings.HasPrefix(s.Tenant, "_") {
+		errs = append(errs, errors.Errorf("invalid %s: %q must not start with '_' with the Redis state manager",
+			SettingTenant, s.Tenant))
+	}
+	return errs
+}
+
+// checkDirection checks the SIP addresses and the billing direction
+func (s *Settings) checkDirection() []error {
+	errs := []error{}
+	for _, address := range s.SIP.Addresses {
+		if net.ParseIP(address) == nil {
+			errs = append(errs, errors.Errorf("invalid %s: %q", SettingSIPAddresses, address))
+		}
+	}
+	if s.SIP.BillingDirection != "" && !isDirection(s.SIP.BillingDirection) {
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingBillingDirection, s.SIP.BillingDirection))
+	} else if s.SIP.BillingDirection != "" && len(s.SIP.Addresses) == 0 {
+		errs = append(errs, errors.Errorf("invalid %s: requires %s", SettingBillingDirection, SettingSIPAddresses))
+	}
+	return errs
+}
+
+func isDirection(direction string) bool {
+	return direction == DirectionIngress || direction == DirectionEgress || direction == DirectionInternal
+}
+
+// checkCaptureAgents checks the settings of the capture agents
+func (s *Settings) checkCaptureAgents() []error {
+	if s.captureAgentsErr != nil {
+		return []error{s.captureAgentsErr}
+	}
+	errs := []error{}
+	ids := map[uint32]bool{}
+	for _, agent := range s.SIP.CaptureAgents {
+		if ids[agent.ID] {
+			errs = append(errs, errors.Errorf("invalid %s: duplicate id %d", SettingCaptureAgents, agent.ID))
+		}
+		ids[agent.ID] = true
+		for _, domain := range agent.LocalDomains {
+			if domain == "" {
+				errs = append(errs, errors.Errorf("invalid %s: empty domain for the agent %d", SettingCaptureAgents, agent.ID))
+				break
+			}
+		}
+		for _, address := range agent.Addresses {
+			if net.ParseIP(address) == nil {
+				errs = append(errs, errors.Errorf("invalid %s: invalid address %q for the agent %d",
+					SettingCaptureAgents, address, agent.ID))
+			}
+		}
+		if agent.Direction != "" && !isDirection(agent.Direction) {
+			errs = append(errs, errors.Errorf("invalid %s: invalid direction %q for the agent %d",
+				SettingCaptureAgents, agent.Direction, agent.ID))
+		} else if agent.Direction != "" && len(agent.Addresses) == 0 && len(s.SIP.Addresses) == 0 {
+			errs = append(errs, errors.Errorf("invalid %s: the direction of the agent %d requires the SIP addresses",
+				SettingCaptureAgents, agent.ID))
+		}
+	}
+	return errs
+}
+
+// checkMessageBus checks the settings of a message bus type
+func (s *Settings) checkMessageBus(busType string) []error {
+	errs := []error{}
+
+	switch busType {
+	case MessageBusTypeRabbitMQ:
+		if u, err := url.Parse(s.MessageBusURI); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingMessageBusURI))
+		} else if u.Scheme != "amqp" && u.Scheme != "amqps" {
+			errs = append(errs, errors.Errorf("invalid %s: unsupported scheme %q", SettingMessageBusURI, u.Scheme))
+		}
+	case MessageBusTypeKafka:
+		if len(s.Kafka.Brokers) == 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must not be empty", SettingKafkaBrokers))
+		}
+		for _, broker := range s.Kafka.Brokers {
+			if err := checkAddress(broker); err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid %s", SettingKafkaBrokers))
+			}
+		}
+		topics := []struct {
+			key, value string
+		}{
+			{SettingKafkaTopicBeginTransaction, s.Kafka.TopicBeginTransaction},
+			{SettingKafkaTopicEndTransaction, s.Kafka.TopicEndTransaction},
+		}
+		if s.PublishCDRs {
+			topics = append(topics, struct{ key, value string }{
+				SettingKafkaTopicCallDetailRecord, s.Kafka.TopicCallDetailRecord,
+			})
+		}
+		for _, topic := range topics {
+			if topic.value == "" {
+				errs = append(errs, errors.Errorf("invalid %s: must not be empty", topic.key))
+			}
+		}
+	case MessageBusTypeNATS:
+		if u, err := url.Parse(s.NATS.URL); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingNATSURL))
+		} else if u.Scheme != "nats" && u.Scheme != "tls" {
+			errs = append(errs, errors.Errorf("invalid %s: unsupported scheme %q", SettingNATSURL, u.Scheme))
+		}
+		if s.NATS.Stream == "" || strings.ContainsAny(s.NATS.Stream, ".*> ") {
+			errs = append(errs, errors.Errorf("invalid %s: %q", SettingNATSStream, s.NATS.Stream))
+		}
+		if s.NATS.SubjectPrefix == "" || strings.ContainsAny(s.NATS.SubjectPrefix, "*> ") {
+			errs = append(errs, errors.Errorf("invalid %s: %q", SettingNATSSubjectPrefix, s.NATS.SubjectPrefix))
+		}
+	case MessageBusTypeWebhook:
+		endpoints := []struct {
+			key, value string
+		}{
+			{SettingWebhookURLBeginTransaction, s.Webhook.URLBeginTransaction},
+			{SettingWebhookURLEndTransaction, s.Webhook.URLEndTransaction},
+		}
+		if s.PublishCDRs {
+			endpoints = append(endpoints, struct{ key, value string }{
+				SettingWebhookURLCallDetailRecord, s.Webhook.URLCallDetailRecord,
+			})
+		}
+		for _, endpoint := range endpoints {
+			if u, err := url.Parse(endpoint.value); err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid %s", endpoint.key))
+			} else if u.Scheme != "http" && u.Scheme != "https" {
+				errs = append(errs, errors.Errorf("invalid %s: unsupported scheme %q", endpoint.key, u.Scheme))
+			}
+		}
+		if s.Webhook.Timeout <= 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must be greater than zero", SettingWebhookTimeout))
+		}
+		if s.Webhook.MaxRetries < 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingWebhookMaxRetries))
+		}
+		if s.Webhook.RetryBackoff < 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingWebhookRetryBackoff))
+		}
+		if s.Webhook.Concurrency < 1 {
+			errs = append(errs, errors.Errorf("invalid %s: must be greater than zero", SettingWebhookConcurrency))
+		}
+	case MessageBusTypeFile:
+		if s.FileSink.Path == "" {
+			errs = append(errs, errors.Errorf("invalid %s: must not be empty", SettingFileSinkPath))
+		}
+	default:
+		errs = append(errs, errors.Errorf("invalid %s: %q", SettingMessageBusType, busType))
+	}
+	return errs
+}
+
+// checkSinks checks the additional sinks of the fan-out publisher
+func (s *Settings) checkSinks() []error {
+	errs := []error{}
+
+	seen := map[string]bool{s.MessageBusType: true}
+	for _, sink := range s.Sinks.Names {
+		if seen[sink] {
+			errs = append(errs, errors.Errorf("invalid %s: duplicated sink %q", SettingMessageBusSinks, sink))
+			continue
+		}
+		seen[sink] = true
+		for _, err := range s.checkMessageBus(sink) {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingMessageBusSinks))
+		}
+	}
+	for _, sink := range s.Sinks.Mandatory {
+		if sink == s.MessageBusType || !seen[sink] {
+			errs = append(errs, errors.Errorf("invalid %s: %q is not an additional sink", SettingMessageBusMandatorySinks,
+				sink))
+		}
+	}
+	if s.Sinks.QueueSize < 1 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater than zero", SettingMessageBusSinkQueueSize))
+	}
+	if s.Sinks.MaxRetries < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingMessageBusSinkMaxRetries))
+	}
+	if s.Sinks.RetryBackoff < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingMessageBusSinkRetryBackoff))
+	}
+
+	return errs
+}
+
+// checkRedis checks the settings of the Redis state manager
+func (s *Settings) checkRedis() []error {
+	var errs []error
+	switch {
+	case s.Redis.SentinelMasterName != "" && len(s.Redis.ClusterAddresses) > 0:
+		errs = append(errs, errors.Errorf("invalid %s: not supported with %s",
+			SettingRedisClusterAddresses, SettingRedisSentinelMasterName))
+	case s.Redis.SentinelMasterName != "":
+		if len(s.Redis.SentinelAddresses) == 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must not be empty", SettingRedisSentinelAddresses))
+		}
+		for _, address := range s.Redis.SentinelAddresses {
+			if err := checkAddress(address); err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid %s", SettingRedisSentinelAddresses))
+			}
+		}
+	case len(s.Redis.ClusterAddresses) > 0:
+		for _, address := range s.Redis.ClusterAddresses {
+			if err := checkAddress(address); err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid %s", SettingRedisClusterAddresses))
+			}
+		}
+		if s.Redis.DB != 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must be zero with %s", SettingRedisDb, SettingRedisClusterAddresses))
+		}
+	default:
+		if err := checkAddress(s.Redis.Address); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s", SettingRedisAddress))
+		}
+	}
+
+	if s.Redis.DB < 0 {
+		errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", SettingRedisDb))
+	}
+	for _, setting := range []struct {
+		key   string
+		value int64
+	}{
+		{SettingRedisPoolSize, int64(s.Redis.PoolSize)},
+		{SettingRedisDialTimeout, int64(s.Redis.DialTimeout)},
+		{SettingRedisReadTimeout, int64(s.Redis.ReadTimeout)},
+		{SettingRedisWriteTimeout, int64(s.Redis.WriteTimeout)},
+		{SettingRedisConnectRetries, int64(s.Redis.ConnectRetries)},
+		{SettingRedisConnectRetryBackoff, int64(s.Redis.ConnectRetryBackoff)},
+	} {
+		if setting.value < 0 {
+			errs = append(errs, errors.Errorf("invalid %s: must be greater or equal to zero", setting.key))
+		}
+	}
+	return errs
+}
+
+func checkAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return errors.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// Effective returns the settings keyed by their configuration name, with the secrets masked
+func (s *Settings) Effective() map[string]interface{} {
+	return map[string]interface{}{
+		SettingListenUDP:                  s.ListenUDP,
+		SettingListenTCP:                  s.ListenTCP,
+		SettingListenSIPUDP:               s.ListenSIPUDP,
+		SettingListenHTTP:                 s.ListenHTTP,
+		SettingAdminToken:                 maskSecret(s.AdminToken),
+		SettingMessageBusType:             s.MessageBusType,
+		SettingMessageBusURI:              maskURI(s.MessageBusURI),
+		SettingPublishCallDetailRecords:   s.PublishCDRs,
+		SettingMessageEncoding:            s.MessageEncoding,
+		SettingKafkaBrokers:               s.Kafka.Brokers,
+		SettingKafkaTopicBeginTransaction: s.Kafka.TopicBeginTransaction,
+		SettingKafkaTopicEndTransaction:   s.Kafka.TopicEndTransaction,
+		SettingKafkaTopicCallDetailRecord: s.Kafka.TopicCallDetailRecord,
+		SettingNATSURL:                    maskURI(s.NATS.URL),
+		SettingNATSStream:                 s.NATS.Stream,
+		SettingNATSSubjectPrefix:          s.NATS.SubjectPrefix,
+		SettingWebhookURLBeginTransaction: maskURI(s.Webhook.URLBeginTransaction),
+		SettingWebhookURLEndTransaction:   maskURI(s.Webhook.URLEndTransaction),
+		SettingWebhookURLCallDetailRecord: maskURI(s.Webhook.URLCallDetailRecord),
+		SettingWebhookSecret:              maskSecret(s.Webhook.Secret),
+		SettingWebhookTimeout:             s.Webhook.Timeout.String(),
+		SettingWebhookMaxRetries:          s.Webhook.MaxRetries,
+		SettingWebhookRetryBackoff:        s.Webhook.RetryBackoff.String(),
+		SettingWebhookConcurrency:         s.Webhook.Concurrency,
+		SettingWebhookDeadLetterFile:      s.Webhook.DeadLetterFile,
+		SettingFileSinkPath:               s.FileSink.Path,
+		SettingFileSinkFormat:             s.FileSink.Format,
+		SettingFileSinkMaxSize:            s.FileSink.MaxSize,
+		SettingFileSinkMaxAge:             s.FileSink.MaxAge.String(),
+		SettingFileSinkCompress:           s.FileSink.Compress,
+		SettingMessageBusSinks:            s.Sinks.Names,
+		SettingMessageBusMandatorySinks:   s.Sinks.Mandatory,
+		SettingMessageBusSinkQueueSize:    s.Sinks.QueueSize,
+		SettingMessageBusSinkMaxRetries:   s.Sinks.MaxRetries,
+		SettingMessageBusSinkRetryBackoff: s.Sinks.RetryBackoff.String(),
+		SettingStateManager:               s.StateManager,
+		SettingRedisAddress:               s.Redis.Address,
+		SettingRedisUsername:              s.Redis.Username,
+		SettingRedisPassword:              maskSecret(s.Redis.Password),
+		SettingRedisDb:                    s.Redis.DB,
+		SettingRedisKeyPrefix:             s.Redis.KeyPrefix,
+		SettingRedisSentinelMasterName:    s.Redis.SentinelMasterName,
+		SettingRedisSentinelAddresses:     s.Redis.SentinelAddresses,
+		SettingRedisSentinelPassword:      maskSecret(s.Redis.SentinelPassword),
+		SettingRedisClusterAddresses:      s.Redis.ClusterAddresses,
+		SettingRedisTLS:                   s.Redis.TLS,
+		SettingRedisTLSCAFile:             s.Redis.TLSCAFile,
+		SettingRedisTLSInsecureSkipVerify: s.Redis.TLSInsecureSkipVerify,
+		SettingRedisPoolSize:              s.Redis.PoolSize,
+		SettingRedisDialTimeout:           s.Redis.DialTimeout.String(),
+		SettingRedisReadTimeout:           s.Redis.ReadTimeout.String(),
+		SettingRedisWriteTimeout:          s.Redis.WriteTimeout.String(),
+		SettingRedisConnectRetries:        s.Redis.ConnectRetries,
+		SettingRedisConnectRetryBackoff:   s.Redis.ConnectRetryBackoff.String(),
+		SettingStateFileDirectory:         s.StateFile.Directory,
+		SettingStateFileSync:              s.StateFile.Sync,
+		SettingSIPAddresses:               s.SIP.Addresses,
+		SettingBillingDirection:           s.SIP.BillingDirection,
+		SettingCaptureAgents:              s.effectiveCaptureAgents(),
+		SettingDedupWindow:                s.Dedup.Window.String(),
+		SettingDedupKey:                   s.Dedup.Key,
+		SettingTenant:                     s.Tenant,
+		SettingSIPHeaderCaller:            s.SIP.HeaderCaller,
+		SettingSIPHeaderCallee:            s.SIP.HeaderCallee,
+		SettingSIPHeaderHistoryInfo:       s.SIP.HeaderHistoryInfo,
+		SettingSIPHeaderHistoryInfoIndex:  s.SIP.HeaderHistoryInfoIndex,
+		SettingSIPLocalDomains:            s.SIP.LocalDomains,
+		SettingAccountTagMatchRegexp:      s.SIP.AccountTagMatchRegexp,
+		SettingProductTag:                 s.ProductTag,
+		SettingTransactionTags:            s.TransactionTags,
+	}
+}
+
+// effectiveCaptureAgents returns the settings of the capture agents, with the keys of
+// the configuration
+func (s *Settings) effectiveCaptureAgents() []map[string]interface{} {
+	agents := make([]map[string]interface{}, 0, len(s.SIP.CaptureAgents))
+	for _, agent := range s.SIP.CaptureAgents {
+		agents = append(agents, map[string]interface{}{
+			"id":            agent.ID,
+			"name":          agent.Name,
+			"local_domains": agent.LocalDomains,
+			"addresses":     agent.Addresses,
+			"direction":     agent.Direction,
+			"billing":       agent.Billing,
+		})
+	}
+	return agents
+}
+
+const maskedSecret = "********"
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return maskedSecret
+}
+
+func maskURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return uri
+	}
+	if password, ok := u.User.Password(); ok && password != "" {
+		masked := url.User(u.User.Username()).String() + ":" + maskedSecret
+		return strings.Replace(uri, u.User.String()+"@", masked+"@", 1)
+	}
+	return uri
+}
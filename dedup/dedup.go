@@ -0,0 +1,135 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/state"
+)
+
+// Supported values for the key of the duplicate filters
+const (
+	// KeyPayload identifies the messages by their SIP payload
+	KeyPayload = "payload"
+	// KeyTransaction identifies the messages by their Call-ID, CSeq, method or
+	// response code and direction, regardless of the headers added by the proxies
+	KeyTransaction = "transaction"
+)
+
+// Interface is the interface of the duplicate filters
+type Interface interface {
+	Connect(ctx context.Context) error
+	Close(ctx context.Context) error
+	// Seen records a key, returning whether it was already recorded in the window
+	Seen(ctx context.Context, key string) (bool, error)
+}
+
+// Key returns the key identifying a SIP message, hashed so that the keys have a
+// fixed length
+func Key(kind string, msg *model.SIPMessage) string {
+	h := sha1.New()
+	if kind == KeyTransaction {
+		var cseq string
+		if msg.Cseq != nil {
+			cseq = msg.Cseq.Val
+		}
+		for _, part := range []string{msg.CallID, cseq, msg.FirstMethod, msg.FirstResp,
+			msg.SourceIP, msg.DestinationIP} {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	} else {
+		h.Write([]byte(msg.Msg))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Local is the duplicate filter of a single agent, which keeps the keys in memory
+type Local struct {
+	window time.Duration
+	keys   map[string]time.Time
+	pruned time.Time
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+// NewLocal returns a new local duplicate filter, recording the keys for the window
+func NewLocal(window time.Duration) *Local {
+	return &Local{
+		window: window,
+		keys:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Connect does nothing, the keys are kept in memory
+func (f *Local) Connect(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, the keys are kept in memory
+func (f *Local) Close(ctx context.Context) error {
+	return nil
+}
+
+// Seen records a key, returning whether it was already recorded in the window; the
+// expired keys are pruned once per window
+func (f *Local) Seen(ctx context.Context, key string) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if now.Sub(f.pruned) >= f.window {
+		for k, expires := range f.keys {
+			if !now.Before(expires) {
+				delete(f.keys, k)
+			}
+		}
+		f.pruned = now
+	}
+	if expires, ok := f.keys[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+	f.keys[key] = now.Add(f.window)
+	return false, nil
+}
+
+// Shared is the duplicate filter of the agents sharing a state manager
+type Shared struct {
+	state state.ManagerInterface
+	ttl   int
+}
+
+// NewShared returns a new duplicate filter recording the keys in a state manager,
+// which should not store the calls; the window is rounded up to the second
+func NewShared(manager state.ManagerInterface, window time.Duration) *Shared {
+	return &Shared{
+		state: manager,
+		ttl:   int(math.Ceil(window.Seconds())),
+	}
+}
+
+// Connect connects the state manager
+func (f *Shared) Connect(ctx context.Context) error {
+	return f.state.Connect(ctx)
+}
+
+// Close closes the state manager
+func (f *Shared) Close(ctx context.Context) error {
+	return f.state.Close(ctx)
+}
+
+// Seen records a key, returning whether it was already recorded in the window by
+// any of the agents
+func (f *Shared) Seen(ctx context.Context, key string) (bool, error) {
+	set, err := f.state.SetIfNotExists(ctx, key, true, f.ttl)
+	if err != nil {
+		return false, err
+	}
+	return !set, nil
+}
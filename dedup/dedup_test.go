@@ -0,0 +1,96 @@
+package dedup
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/processor"
+	"github.com/canyanio/rating-agent-hep/state"
+)
+
+const invite = "INVITE sip:39040123456@anotherdomain.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.168.192.2:5060;branch=z9hG4bK-18-1-0\r\n" +
+	"From: sipp <sip:1000@192.168.192.2:5060>;tag=1\r\n" +
+	"To: sut <sip:39040123456@anotherdomain.com>\r\n" +
+	"Call-ID: 1-18@192.168.192.2\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestKey(t *testing.T) {
+	p := processor.NewHEPProcessor(&dconfig.SIPSettings{})
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+
+	msg, err := p.ProcessSIP([]byte(invite), ts, src, dst)
+	assert.Nil(t, err)
+	// the copy forwarded by a proxy has an additional Via header
+	proxied, err := p.ProcessSIP([]byte("INVITE sip:39040123456@anotherdomain.com SIP/2.0\r\n"+
+		"Via: SIP/2.0/UDP 192.168.192.3:5060;branch=z9hG4bK-proxy\r\n"+
+		invite[len("INVITE sip:39040123456@anotherdomain.com SIP/2.0\r\n"):]), ts, src, dst)
+	assert.Nil(t, err)
+	reversed, err := p.ProcessSIP([]byte(invite), ts, dst, src)
+	assert.Nil(t, err)
+
+	assert.Len(t, Key(KeyPayload, msg), 40)
+	assert.NotEqual(t, Key(KeyPayload, msg), Key(KeyPayload, proxied))
+	assert.Equal(t, Key(KeyPayload, msg), Key(KeyPayload, reversed))
+
+	assert.Equal(t, Key(KeyTransaction, msg), Key(KeyTransaction, proxied))
+	assert.NotEqual(t, Key(KeyTransaction, msg), Key(KeyTransaction, reversed))
+	assert.NotEqual(t, Key(KeyPayload, msg), Key(KeyTransaction, msg))
+}
+
+func TestLocal(t *testing.T) {
+	f := NewLocal(2 * time.Second)
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	seen, err := f.Seen(ctx, "key1")
+	assert.Nil(t, err)
+	assert.False(t, seen)
+
+	now = now.Add(time.Second)
+	seen, _ = f.Seen(ctx, "key1")
+	assert.True(t, seen)
+	seen, _ = f.Seen(ctx, "key2")
+	assert.False(t, seen)
+
+	// the window starts when the key is seen the first time
+	now = now.Add(time.Second)
+	seen, _ = f.Seen(ctx, "key1")
+	assert.False(t, seen)
+
+	// the expired keys are pruned
+	now = now.Add(2 * time.Second)
+	f.Seen(ctx, "key3")
+	assert.Len(t, f.keys, 1)
+}
+
+func TestShared(t *testing.T) {
+	mgr := state.NewMemoryManager()
+	f1 := NewShared(mgr, 1500*time.Millisecond)
+	f2 := NewShared(mgr, 1500*time.Millisecond)
+	assert.Equal(t, 2, f1.ttl)
+	ctx := context.Background()
+
+	err := f1.Connect(ctx)
+	assert.Nil(t, err)
+
+	seen, err := f1.Seen(ctx, "key")
+	assert.Nil(t, err)
+	assert.False(t, seen)
+
+	seen, err = f2.Seen(ctx, "key")
+	assert.Nil(t, err)
+	assert.True(t, seen)
+
+	err = f1.Close(ctx)
+	assert.Nil(t, err)
+}
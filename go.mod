@@ -3,15 +3,25 @@ module github.com/canyanio/rating-agent-hep
 go 1.13
 
 require (
-	github.com/go-redis/redis/v7 v7.2.0
+	github.com/Shopify/sarama v1.26.4
+	github.com/alecthomas/jsonschema v0.0.0-20210920000243-787cd8204a0d
+	github.com/go-redis/redis/v7 v7.4.1
+	github.com/golang/protobuf v1.4.2
 	github.com/google/uuid v1.1.1
 	github.com/mendersoftware/go-lib-micro v0.0.0-20200205133950-a5eb0bc64551
+	github.com/mitchellh/mapstructure v1.1.2
+	github.com/nats-io/nats.go v1.11.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.5.1
 	github.com/sipcapture/heplify-server v0.0.0-20200309180217-ea033097697e
 	github.com/sirupsen/logrus v1.4.2
-	github.com/spf13/viper v1.6.2 // indirect
+	github.com/spf13/viper v1.6.2
 	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71
 	github.com/stretchr/testify v1.5.1
 	github.com/urfave/cli v1.22.3
-	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"os"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
 
+	"github.com/canyanio/rating-agent-hep/client/admin"
+	"github.com/canyanio/rating-agent-hep/client/jsonl"
 	"github.com/canyanio/rating-agent-hep/config"
 	"github.com/canyanio/rating-agent-hep/server"
 )
 
+var adminFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "url",
+		Usage: "Base `URL` of the agent admin API; defaults to the listen_http address",
+	},
+	&cli.StringFlag{
+		Name:   "token",
+		Usage:  "Admin API `TOKEN`; defaults to the admin_token setting",
+		EnvVar: "RATING_AGENT_HEP_ADMIN_TOKEN",
+	},
+	&cli.StringFlag{
+		Name:  "reason",
+		Usage: "`REASON` of the action, recorded in the audit log",
+	},
+}
+
 func main() {
 	doMain(os.Args)
 }
@@ -34,23 +58,86 @@ func doMain(args []string) {
 		},
 		Commands: []cli.Command{
 			{
-				Name:   "agent",
-				Usage:  "Run the HEP agent",
-				Action: cmdAgent,
-				Flags:  []cli.Flag{},
+				Name:  "agent",
+				Usage: "Run the HEP agent",
+				Action: func(args *cli.Context) error {
+					return cmdAgent(args, configPath)
+				},
+				Flags: []cli.Flag{},
+			},
+			{
+				Name:      "replay",
+				Usage:     "Replay the HEP or raw SIP packets from a pcap/pcapng capture file",
+				ArgsUsage: "FILE",
+				Action: func(args *cli.Context) error {
+					return cmdReplay(args, configPath)
+				},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Write the requests as JSON lines instead of publishing them",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "Output `FILE` for the dry run, \"-\" for the standard output",
+						Value: "-",
+					},
+				},
+			},
+			{
+				Name:  "call",
+				Usage: "Force-close or discard a call tracked by a running agent, through its admin API",
+				Subcommands: []cli.Command{
+					{
+						Name:      "close",
+						Usage:     "Close the call and publish the end transaction",
+						ArgsUsage: "CALL-ID",
+						Action: func(args *cli.Context) error {
+							return cmdCallClose(args, configPath)
+						},
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "end-time",
+								Usage: "End `TIME` of the call, in RFC 3339 format; defaults to now",
+							},
+						}, adminFlags...),
+					},
+					{
+						Name:      "discard",
+						Usage:     "Discard the call without billing it",
+						ArgsUsage: "CALL-ID",
+						Action: func(args *cli.Context) error {
+							return cmdCallDiscard(args, configPath)
+						},
+						Flags: adminFlags,
+					},
+				},
+			},
+			{
+				Name:  "migrate-state",
+				Usage: "Move the calls stored in Redis by the previous versions of the agent to the current keys",
+				Action: func(args *cli.Context) error {
+					return cmdMigrateState(args, configPath)
+				},
+				Flags: []cli.Flag{},
+			},
+			{
+				Name:  "validate-config",
+				Usage: "Validate the configuration and print the effective settings",
+				Action: func(args *cli.Context) error {
+					return cmdValidateConfig(args, configPath)
+				},
+				Flags: []cli.Flag{},
 			},
 		},
 	}
 	app.Usage = "rating-agent-hep"
 	app.Version = "1.0.0"
-	app.Action = cmdAgent
+	app.Action = func(args *cli.Context) error {
+		return cmdAgent(args, configPath)
+	}
 
 	app.Before = func(args *cli.Context) error {
-		err := config.Init(configPath)
-		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-
 		log.Setup(configDebug)
 
 		return nil
@@ -62,8 +149,161 @@ func doMain(args []string) {
 	}
 }
 
-func cmdAgent(args *cli.Context) error {
-	srv := server.NewServer()
-	err := srv.Start()
+func cmdAgent(args *cli.Context, configPath string) error {
+	settings, err := config.Init(configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	srv := server.NewServer(settings)
+	err = srv.Start()
 	return err
 }
+
+func cmdReplay(args *cli.Context, configPath string) error {
+	if args.NArg() != 1 {
+		return cli.NewExitError("missing the capture FILE to replay", 1)
+	}
+
+	settings, err := config.Init(configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	f, err := os.Open(args.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer f.Close()
+
+	srv := server.NewServer(settings)
+	if args.Bool("dry-run") {
+		output := args.App.Writer
+		if path := args.String("output"); path != "-" {
+			out, err := os.Create(path)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			defer out.Close()
+			output = out
+		}
+		srv.SetDryRun(jsonl.NewClient(output))
+	}
+
+	if err := srv.Replay(f); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+func newAdminClient(args *cli.Context, configPath string) (*admin.Client, error) {
+	settings, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := args.String("url")
+	if baseURL == "" {
+		if settings.ListenHTTP == "" {
+			return nil, errors.New("listen_http is not set, use --url")
+		}
+		host, port, err := net.SplitHostPort(settings.ListenHTTP)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		baseURL = "http://" + net.JoinHostPort(host, port)
+	}
+
+	token := args.String("token")
+	if token == "" {
+		token = settings.AdminToken
+	}
+	return admin.NewClient(baseURL, token), nil
+}
+
+func cmdCallClose(args *cli.Context, configPath string) error {
+	if args.NArg() != 1 {
+		return cli.NewExitError("missing the CALL-ID to close", 1)
+	}
+
+	var timestampEnd time.Time
+	if endTime := args.String("end-time"); endTime != "" {
+		var err error
+		timestampEnd, err = time.Parse(time.RFC3339, endTime)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("invalid end time: %s", err), 1)
+		}
+	}
+
+	client, err := newAdminClient(args, configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	call, err := client.CloseCall(context.Background(), args.Args().First(), timestampEnd, args.String("reason"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Fprintf(args.App.Writer, "call %s closed at %s\n", call.TransactionTag, call.TimestampBye.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func cmdCallDiscard(args *cli.Context, configPath string) error {
+	if args.NArg() != 1 {
+		return cli.NewExitError("missing the CALL-ID to discard", 1)
+	}
+
+	client, err := newAdminClient(args, configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	call, err := client.DiscardCall(context.Background(), args.Args().First(), args.String("reason"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Fprintf(args.App.Writer, "call %s discarded\n", call.TransactionTag)
+	return nil
+}
+
+func cmdMigrateState(args *cli.Context, configPath string) error {
+	settings, err := config.Init(configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	srv := server.NewServer(settings)
+	migrated, err := srv.MigrateState(context.Background())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Fprintf(args.App.Writer, "%d call(s) migrated\n", migrated)
+	return nil
+}
+
+func cmdValidateConfig(args *cli.Context, configPath string) error {
+	settings, err := config.Load(configPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	effective, err := yaml.Marshal(settings.Effective())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Fprintf(args.App.Writer, "# effective configuration\n%s", effective)
+
+	errs := settings.Check()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(cli.ErrWriter, "error: %s\n", err)
+		}
+		return cli.NewExitError(fmt.Sprintf("configuration is not valid: %d error(s)", len(errs)), 1)
+	}
+
+	fmt.Fprintln(args.App.Writer, "# configuration is valid")
+	return nil
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the namespace of the agent metrics
+const Namespace = "rating_agent_hep"
+
+// Listener label values
+const (
+	ListenerUDP    = "udp"
+	ListenerTCP    = "tcp"
+	ListenerSIPUDP = "sip_udp"
+	ListenerReplay = "replay"
+)
+
+// MethodResponse is the method label value of the SIP responses
+const MethodResponse = "response"
+
+// Result label values of the RTCP reports
+const (
+	QualityReportAggregated  = "aggregated"
+	QualityReportUnknownCall = "unknown_call"
+	QualityReportConflict    = "conflict"
+)
+
+var (
+	// PacketsReceived counts the packets received, per listener
+	PacketsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "packets_received_total",
+		Help:      "Number of packets received, per listener.",
+	}, []string{"listener"})
+
+	// DecodeFailures counts the packets which cannot be decoded, per listener
+	DecodeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "decode_failures_total",
+		Help:      "Number of packets which cannot be decoded, per listener.",
+	}, []string{"listener"})
+
+	// SIPMessages counts the SIP messages seen, per method
+	SIPMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sip_messages_total",
+		Help:      "Number of SIP messages seen, per method; responses are counted as RESPONSE.",
+	}, []string{"method"})
+
+	// MessagesWithoutInvite counts the SIP messages received for calls without an INVITE, per method
+	MessagesWithoutInvite = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "messages_without_invite_total",
+		Help:      "Number of SIP messages received for calls whose INVITE has not been seen, per method.",
+	}, []string{"method"})
+
+	// DuplicateMessages counts the duplicate SIP messages dropped, per capture agent
+	DuplicateMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "duplicate_messages_total",
+		Help:      "Number of duplicate SIP messages dropped, per capture agent.",
+	}, []string{"capture_agent"})
+
+	// SkippedTransitions counts the SIP messages whose call transition was already
+	// applied, by another agent or by a retransmission, per method
+	SkippedTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "skipped_transitions_total",
+		Help:      "Number of SIP messages whose call transition was already applied, per method.",
+	}, []string{"method"})
+
+	// QualityReports counts the RTCP reports received, per result
+	QualityReports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "quality_reports_total",
+		Help:      "Number of RTCP reports received, per result: aggregated, unknown_call or conflict.",
+	}, []string{"result"})
+
+	// Published counts the requests published, per type
+	Published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "published_total",
+		Help:      "Number of requests published, per type.",
+	}, []string{"type"})
+
+	// PublishFailures counts the requests which cannot be published, per type
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "publish_failures_total",
+		Help:      "Number of requests which cannot be published, per type.",
+	}, []string{"type"})
+
+	// SinkPublished counts the requests published by the fan-out publisher, per sink
+	SinkPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sink_published_total",
+		Help:      "Number of requests published, per sink.",
+	}, []string{"sink"})
+
+	// SinkFailures counts the failed publishing attempts of the fan-out publisher, per sink
+	SinkFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sink_failures_total",
+		Help:      "Number of failed publishing attempts, per sink.",
+	}, []string{"sink"})
+
+	// SinkRetries counts the publishing attempts retried by the fan-out publisher, per sink
+	SinkRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sink_retries_total",
+		Help:      "Number of publishing attempts retried, per optional sink.",
+	}, []string{"sink"})
+
+	// SinkDropped counts the requests dropped by the fan-out publisher, per sink
+	SinkDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sink_dropped_total",
+		Help:      "Number of requests dropped because the queue is full or the retries are exhausted, per optional sink.",
+	}, []string{"sink"})
+
+	// SinkQueueLength is the number of requests waiting to be published, per sink
+	SinkQueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "sink_queue_length",
+		Help:      "Number of requests waiting to be published, per optional sink.",
+	}, []string{"sink"})
+
+	// HandleDuration observes the time spent handling a packet
+	HandleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "handle_duration_seconds",
+		Help:      "Time spent handling a packet, in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+
+	// CallDuration observes the duration of the calls, from the ACK to the BYE
+	CallDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "call_duration_seconds",
+		Help:      "Duration of the answered calls, in seconds.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200},
+	})
+
+	// ActiveCalls is the number of calls tracked by the state manager, counted
+	// periodically as counting them can require a scan of the state manager
+	ActiveCalls = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "active_calls",
+		Help:      "Number of calls tracked by the state manager.",
+	})
+)
+
+// Handler returns the HTTP handler which exposes the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,12 @@
+package model
+
+// CloseCallRequest is the admin request to force-close a tracked call
+type CloseCallRequest struct {
+	TimestampEnd string `json:"timestamp_end,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// DiscardCallRequest is the admin request to discard a tracked call without billing it
+type DiscardCallRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
@@ -4,16 +4,32 @@ import (
 	"time"
 )
 
+// JSON fields of the call updated individually in the state manager
+const (
+	CallFieldTimestampAck = "timestamp_ack"
+	CallFieldTimestampBye = "timestamp_bye"
+	CallFieldFinalCode    = "final_code"
+)
+
 // Call stores the status of a call in the state manager
 type Call struct {
-	Tenant                string    `json:"tenant"`
-	TransactionTag        string    `json:"transaction_tag"`
-	AccountTag            string    `json:"account_tag"`
-	DestinationAccountTag string    `json:"destination_account_tag"`
-	Source                string    `json:"source"`
-	Destination           string    `json:"destination"`
-	CSeq                  string    `json:"cseq"`
-	TimestampInvite       time.Time `json:"timestamp_begin"`
-	TimestampAck          time.Time `json:"timestamp_ack"`
-	TimestampBye          time.Time `json:"timestamp_bye"`
+	Tenant                string       `json:"tenant"`
+	TransactionTag        string       `json:"transaction_tag"`
+	AccountTag            string       `json:"account_tag"`
+	DestinationAccountTag string       `json:"destination_account_tag"`
+	Source                string       `json:"source"`
+	Destination           string       `json:"destination"`
+	SourceIP              string       `json:"source_ip,omitempty"`
+	SourcePort            uint32       `json:"source_port,omitempty"`
+	DestinationIP         string       `json:"destination_ip,omitempty"`
+	DestinationPort       uint32       `json:"destination_port,omitempty"`
+	CaptureAgentID        uint32       `json:"capture_agent_id,omitempty"`
+	CaptureAgentName      string       `json:"capture_agent_name,omitempty"`
+	Direction             string       `json:"direction,omitempty"`
+	CSeq                  string       `json:"cseq"`
+	TimestampInvite       time.Time    `json:"timestamp_begin"`
+	TimestampAck          time.Time    `json:"timestamp_ack"`
+	TimestampBye          time.Time    `json:"timestamp_bye"`
+	FinalCode             int          `json:"final_code,omitempty"`
+	Quality               *CallQuality `json:"quality,omitempty"`
 }
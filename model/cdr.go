@@ -0,0 +1,113 @@
+package model
+
+import (
+	"time"
+)
+
+// CallDetailRecordSchemaVersion is the version of the call detail record schema,
+// the major version is incremented on backward incompatible changes
+const CallDetailRecordSchemaVersion = "1.3"
+
+// Dispositions of the call detail records
+const (
+	DispositionAnswered  = "answered"
+	DispositionCancelled = "cancelled"
+	DispositionBusy      = "busy"
+	DispositionNoAnswer  = "no_answer"
+	DispositionFailed    = "failed"
+)
+
+// CallDetailRecord is the consolidated record of a call, published when the call ends
+type CallDetailRecord struct {
+	SchemaVersion         string          `json:"schema_version" jsonschema:"pattern=^1\\.[0-9]+$"`
+	Tenant                string          `json:"tenant"`
+	TransactionTag        string          `json:"transaction_tag"`
+	AccountTag            string          `json:"account_tag"`
+	DestinationAccountTag string          `json:"destination_account_tag"`
+	Source                string          `json:"source"`
+	Destination           string          `json:"destination"`
+	SourceIP              string          `json:"source_ip,omitempty"`
+	DestinationIP         string          `json:"destination_ip,omitempty"`
+	CaptureAgentID        uint32          `json:"capture_agent_id,omitempty"`
+	CaptureAgentName      string          `json:"capture_agent_name,omitempty"`
+	Direction             string          `json:"direction,omitempty" jsonschema:"enum=ingress,enum=egress,enum=internal"`
+	ProductTag            string          `json:"product_tag,omitempty"`
+	Tags                  []string        `json:"tags,omitempty"`
+	TimestampInvite       string          `json:"timestamp_invite" jsonschema:"format=date-time"`
+	TimestampAnswer       string          `json:"timestamp_answer,omitempty" jsonschema:"format=date-time"`
+	TimestampEnd          string          `json:"timestamp_end" jsonschema:"format=date-time"`
+	Duration              int64           `json:"duration"`
+	Disposition           string          `json:"disposition" jsonschema:"enum=answered,enum=cancelled,enum=busy,enum=no_answer,enum=failed"`
+	SIPFinalCode          int             `json:"sip_final_code,omitempty"`
+	Quality               *QualitySummary `json:"quality,omitempty"`
+	CSeq                  string          `json:"-"`
+}
+
+// NewCallDetailRecord returns the record of a call ended at the given time
+func NewCallDetailRecord(call *Call, timestampEnd time.Time, productTag string, tags []string) *CallDetailRecord {
+	cdr := &CallDetailRecord{
+		SchemaVersion:         CallDetailRecordSchemaVersion,
+		Tenant:                call.Tenant,
+		TransactionTag:        call.TransactionTag,
+		AccountTag:            call.AccountTag,
+		DestinationAccountTag: call.DestinationAccountTag,
+		Source:                call.Source,
+		Destination:           call.Destination,
+		SourceIP:              call.SourceIP,
+		DestinationIP:         call.DestinationIP,
+		CaptureAgentID:        call.CaptureAgentID,
+		CaptureAgentName:      call.CaptureAgentName,
+		Direction:             call.Direction,
+		ProductTag:            productTag,
+		Tags:                  tags,
+		TimestampInvite:       call.TimestampInvite.UTC().Format(time.RFC3339),
+		TimestampEnd:          timestampEnd.UTC().Format(time.RFC3339),
+		SIPFinalCode:          call.FinalCode,
+		Quality:               call.Quality.Summary(),
+		CSeq:                  call.CSeq,
+	}
+	answered := !call.TimestampAck.IsZero()
+	if answered {
+		cdr.TimestampAnswer = call.TimestampAck.UTC().Format(time.RFC3339)
+		if timestampEnd.After(call.TimestampAck) {
+			cdr.Duration = int64(timestampEnd.Sub(call.TimestampAck) / time.Second)
+		}
+	}
+	cdr.Disposition = CallDisposition(call.FinalCode, answered)
+	return cdr
+}
+
+// CallDisposition returns the disposition of a call from its final SIP response code
+func CallDisposition(finalCode int, answered bool) string {
+	switch {
+	case answered || (finalCode >= 200 && finalCode < 300):
+		return DispositionAnswered
+	case finalCode == 487:
+		return DispositionCancelled
+	case finalCode == 486 || finalCode == 600:
+		return DispositionBusy
+	case finalCode == 408 || finalCode == 480:
+		return DispositionNoAnswer
+	}
+	return DispositionFailed
+}
+
+// GetTenant returns the tenant of the call
+func (r *CallDetailRecord) GetTenant() string {
+	return r.Tenant
+}
+
+// GetTransactionTag returns the transaction tag, that is the SIP Call-ID
+func (r *CallDetailRecord) GetTransactionTag() string {
+	return r.TransactionTag
+}
+
+// GetCSeq returns the CSeq number of the INVITE of the call, not published
+func (r *CallDetailRecord) GetCSeq() string {
+	return r.CSeq
+}
+
+// GetSchemaVersion returns the version of the schema of the record
+func (r *CallDetailRecord) GetSchemaVersion() string {
+	return r.SchemaVersion
+}
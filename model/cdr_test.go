@@ -0,0 +1,87 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallDisposition(t *testing.T) {
+	var tests = []struct {
+		finalCode   int
+		answered    bool
+		disposition string
+	}{
+		{200, true, DispositionAnswered},
+		{0, true, DispositionAnswered},
+		{200, false, DispositionAnswered},
+		{487, false, DispositionCancelled},
+		{486, false, DispositionBusy},
+		{600, false, DispositionBusy},
+		{408, false, DispositionNoAnswer},
+		{480, false, DispositionNoAnswer},
+		{404, false, DispositionFailed},
+		{503, false, DispositionFailed},
+		{0, false, DispositionFailed},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.disposition, CallDisposition(test.finalCode, test.answered))
+	}
+}
+
+func TestNewCallDetailRecord(t *testing.T) {
+	invite := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	call := &Call{
+		Tenant:          "default",
+		TransactionTag:  "call-1",
+		AccountTag:      "1000",
+		Source:          "sip:1000@example.com",
+		Destination:     "sip:2000@example.com",
+		SourceIP:        "10.0.0.1",
+		DestinationIP:   "10.0.0.2",
+		CaptureAgentID:  2001,
+		Direction:       DirectionIngress,
+		CSeq:            "1",
+		TimestampInvite: invite,
+		TimestampAck:    invite.Add(3 * time.Second),
+		FinalCode:       200,
+	}
+
+	cdr := NewCallDetailRecord(call, invite.Add(65*time.Second), "VOICE", []string{"tag1"})
+	assert.Equal(t, &CallDetailRecord{
+		SchemaVersion:   CallDetailRecordSchemaVersion,
+		Tenant:          "default",
+		TransactionTag:  "call-1",
+		AccountTag:      "1000",
+		Source:          "sip:1000@example.com",
+		Destination:     "sip:2000@example.com",
+		SourceIP:        "10.0.0.1",
+		DestinationIP:   "10.0.0.2",
+		CaptureAgentID:  2001,
+		Direction:       DirectionIngress,
+		ProductTag:      "VOICE",
+		Tags:            []string{"tag1"},
+		TimestampInvite: "2020-03-14T08:56:08Z",
+		TimestampAnswer: "2020-03-14T08:56:11Z",
+		TimestampEnd:    "2020-03-14T08:57:13Z",
+		Duration:        62,
+		Disposition:     DispositionAnswered,
+		SIPFinalCode:    200,
+		CSeq:            "1",
+	}, cdr)
+	assert.Equal(t, "default", cdr.GetTenant())
+	assert.Equal(t, "call-1", cdr.GetTransactionTag())
+}
+
+func TestMessageID(t *testing.T) {
+	cdr := &CallDetailRecord{TransactionTag: "call-1"}
+	assert.Equal(t, "call-1:call_detail_record", MessageID(cdr, "call_detail_record"))
+
+	cdr.CSeq = "2"
+	assert.Equal(t, "call-1:2:call_detail_record", MessageID(cdr, "call_detail_record"))
+	assert.Equal(t, "call-1:2:end_transaction", MessageID(&EndTransaction{
+		Request: EndTransactionRequest{TransactionTag: "call-1"},
+		CSeq:    "2",
+	}, "end_transaction"))
+}
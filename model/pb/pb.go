@@ -0,0 +1,89 @@
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative events.proto
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// FromModel returns the Protocol Buffers message of a model event
+func FromModel(req interface{}) (proto.Message, error) {
+	switch event := req.(type) {
+	case *model.BeginTransaction:
+		return &BeginTransaction{
+			SchemaVersion: event.SchemaVersion,
+			Request: &BeginTransactionRequest{
+				Tenant:                event.Request.Tenant,
+				TransactionTag:        event.Request.TransactionTag,
+				AccountTag:            event.Request.AccountTag,
+				DestinationAccountTag: event.Request.DestinationAccountTag,
+				Source:                event.Request.Source,
+				Destination:           event.Request.Destination,
+				ProductTag:            event.Request.ProductTag,
+				Tags:                  event.Request.Tags,
+				TimestampBegin:        event.Request.TimestampBegin,
+				CaptureAgentId:        event.Request.CaptureAgentID,
+				CaptureAgentName:      event.Request.CaptureAgentName,
+				Direction:             event.Request.Direction,
+			},
+		}, nil
+	case *model.EndTransaction:
+		return &EndTransaction{
+			SchemaVersion: event.SchemaVersion,
+			Request: &EndTransactionRequest{
+				Tenant:                event.Request.Tenant,
+				TransactionTag:        event.Request.TransactionTag,
+				AccountTag:            event.Request.AccountTag,
+				DestinationAccountTag: event.Request.DestinationAccountTag,
+				TimestampEnd:          event.Request.TimestampEnd,
+				CaptureAgentId:        event.Request.CaptureAgentID,
+				CaptureAgentName:      event.Request.CaptureAgentName,
+				Direction:             event.Request.Direction,
+				Quality:               fromQualitySummary(event.Request.Quality),
+			},
+		}, nil
+	case *model.CallDetailRecord:
+		return &CallDetailRecord{
+			SchemaVersion:         event.SchemaVersion,
+			Tenant:                event.Tenant,
+			TransactionTag:        event.TransactionTag,
+			AccountTag:            event.AccountTag,
+			DestinationAccountTag: event.DestinationAccountTag,
+			Source:                event.Source,
+			Destination:           event.Destination,
+			SourceIp:              event.SourceIP,
+			DestinationIp:         event.DestinationIP,
+			CaptureAgentId:        event.CaptureAgentID,
+			ProductTag:            event.ProductTag,
+			Tags:                  event.Tags,
+			TimestampInvite:       event.TimestampInvite,
+			TimestampAnswer:       event.TimestampAnswer,
+			TimestampEnd:          event.TimestampEnd,
+			Duration:              event.Duration,
+			Disposition:           event.Disposition,
+			SipFinalCode:          int32(event.SIPFinalCode),
+			CaptureAgentName:      event.CaptureAgentName,
+			Direction:             event.Direction,
+			Quality:               fromQualitySummary(event.Quality),
+		}, nil
+	}
+	return nil, errors.Errorf("unsupported request type: %T", req)
+}
+
+func fromQualitySummary(quality *model.QualitySummary) *QualitySummary {
+	if quality == nil {
+		return nil
+	}
+	return &QualitySummary{
+		Samples:       int32(quality.Samples),
+		JitterAvg:     quality.JitterAvg,
+		JitterMax:     quality.JitterMax,
+		PacketLossAvg: quality.PacketLossAvg,
+		PacketLossMax: quality.PacketLossMax,
+		MosAvg:        quality.MOSAvg,
+		MosMin:        quality.MOSMin,
+	}
+}
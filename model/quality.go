@@ -0,0 +1,166 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sipcapture/heplify-server/decoder"
+
+	"github.com/canyanio/rating-agent-hep/rtcp"
+)
+
+// HEP protocol types
+const (
+	HEPProtoTypeSIP  = 1
+	HEPProtoTypeRTCP = 5
+)
+
+// QualityClockRate is the RTP clock rate used to convert the RTCP jitter to
+// milliseconds, the one of the narrowband codecs
+const QualityClockRate = 8000
+
+// CallFieldQuality is the JSON field of the call storing the quality aggregates
+const CallFieldQuality = "quality"
+
+// QualitySample is the quality of an RTP stream, from an RTCP report block
+type QualitySample struct {
+	// Jitter in milliseconds
+	Jitter float64
+	// PacketLoss in percent
+	PacketLoss float64
+	MOS        float64
+}
+
+// QualityReport is an RTCP report, correlated to a call by the HEP correlation ID
+type QualityReport struct {
+	CallID         string
+	Timestamp      time.Time
+	SourceIP       string
+	DestinationIP  string
+	CaptureAgentID uint32
+	Samples        []QualitySample
+}
+
+// QualityReportFromHEP returns a QualityReport from a decoded HEP packet carrying RTCP
+func QualityReportFromHEP(hep *decoder.HEP) (*QualityReport, error) {
+	if hep.CID == "" {
+		return nil, errors.New("unable to correlate the RTCP report: missing correlation ID")
+	}
+	report, err := rtcp.Decode([]byte(hep.Payload))
+	if err != nil {
+		return nil, err
+	}
+	quality := &QualityReport{
+		CallID:         hep.CID,
+		Timestamp:      hep.Timestamp,
+		SourceIP:       hep.SrcIP,
+		DestinationIP:  hep.DstIP,
+		CaptureAgentID: hep.NodeID,
+	}
+	// the MOS of the VoIP metrics, if any, replaces the estimated one
+	mos := map[uint32]float64{}
+	for _, metrics := range report.VoIPMetrics {
+		if metrics.MOSLQ > 0 {
+			mos[metrics.SSRC] = metrics.MOSLQ
+		}
+	}
+	for _, block := range report.Blocks {
+		sample := QualitySample{
+			Jitter:     float64(block.Jitter) * 1000 / QualityClockRate,
+			PacketLoss: block.FractionLost * 100,
+		}
+		if value, ok := mos[block.SSRC]; ok {
+			sample.MOS = value
+			delete(mos, block.SSRC)
+		} else {
+			sample.MOS = EstimateMOS(sample.Jitter, sample.PacketLoss)
+		}
+		quality.Samples = append(quality.Samples, sample)
+	}
+	for _, metrics := range report.VoIPMetrics {
+		if value, ok := mos[metrics.SSRC]; ok {
+			quality.Samples = append(quality.Samples, QualitySample{
+				PacketLoss: metrics.LossRate * 100,
+				MOS:        value,
+			})
+		}
+	}
+	return quality, nil
+}
+
+// EstimateMOS estimates the MOS from the jitter, in milliseconds, and the packet loss,
+// in percent, with the simplified E-model (ITU-T G.107) ignoring the network delay
+func EstimateMOS(jitter, packetLoss float64) float64 {
+	latency := jitter*2 + 10
+	r := 93.2 - latency/40
+	if latency >= 160 {
+		r = 93.2 - (latency-120)/10
+	}
+	r -= packetLoss * 2.5
+	if r <= 0 {
+		return 1
+	} else if r >= 100 {
+		return 4.5
+	}
+	return 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+}
+
+// CallQuality aggregates the quality samples of a call in the state manager
+type CallQuality struct {
+	Samples         int     `json:"samples"`
+	JitterTotal     float64 `json:"jitter_total"`
+	JitterMax       float64 `json:"jitter_max"`
+	PacketLossTotal float64 `json:"packet_loss_total"`
+	PacketLossMax   float64 `json:"packet_loss_max"`
+	MOSTotal        float64 `json:"mos_total"`
+	MOSMin          float64 `json:"mos_min"`
+}
+
+// Add adds a sample to the aggregates
+func (q *CallQuality) Add(sample QualitySample) {
+	if q.Samples == 0 || sample.MOS < q.MOSMin {
+		q.MOSMin = sample.MOS
+	}
+	q.Samples++
+	q.JitterTotal += sample.Jitter
+	q.JitterMax = math.Max(q.JitterMax, sample.Jitter)
+	q.PacketLossTotal += sample.PacketLoss
+	q.PacketLossMax = math.Max(q.PacketLossMax, sample.PacketLoss)
+	q.MOSTotal += sample.MOS
+}
+
+// Summary returns the summary of the quality of a call, nil without samples
+func (q *CallQuality) Summary() *QualitySummary {
+	if q == nil || q.Samples == 0 {
+		return nil
+	}
+	samples := float64(q.Samples)
+	return &QualitySummary{
+		Samples:       q.Samples,
+		JitterAvg:     round(q.JitterTotal / samples),
+		JitterMax:     round(q.JitterMax),
+		PacketLossAvg: round(q.PacketLossTotal / samples),
+		PacketLossMax: round(q.PacketLossMax),
+		MOSAvg:        round(q.MOSTotal / samples),
+		MOSMin:        round(q.MOSMin),
+	}
+}
+
+// QualitySummary is the summary of the quality of a call, published when the call ends
+type QualitySummary struct {
+	// Samples is the number of RTCP report blocks
+	Samples int `json:"samples"`
+	// JitterAvg and JitterMax are in milliseconds
+	JitterAvg float64 `json:"jitter_avg"`
+	JitterMax float64 `json:"jitter_max"`
+	// PacketLossAvg and PacketLossMax are in percent
+	PacketLossAvg float64 `json:"packet_loss_avg"`
+	PacketLossMax float64 `json:"packet_loss_max"`
+	MOSAvg        float64 `json:"mos_avg"`
+	MOSMin        float64 `json:"mos_min"`
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
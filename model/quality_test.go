@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipcapture/heplify-server/decoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityReportFromHEP(t *testing.T) {
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	hep := &decoder.HEP{
+		ProtoType: HEPProtoTypeRTCP,
+		Payload: `{"ssrc":1,"report_blocks":[` +
+			`{"source_ssrc":2,"fraction_lost":0,"ia_jitter":80},` +
+			`{"source_ssrc":3,"fraction_lost":128,"ia_jitter":800}]}`,
+		CID:       "call-1",
+		SrcIP:     "10.0.0.2",
+		DstIP:     "10.0.0.1",
+		NodeID:    2001,
+		Timestamp: ts,
+	}
+
+	report, err := QualityReportFromHEP(hep)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", report.CallID)
+	assert.Equal(t, ts, report.Timestamp)
+	assert.Equal(t, "10.0.0.2", report.SourceIP)
+	assert.Equal(t, "10.0.0.1", report.DestinationIP)
+	assert.Equal(t, uint32(2001), report.CaptureAgentID)
+	assert.Len(t, report.Samples, 2)
+	assert.Equal(t, float64(10), report.Samples[0].Jitter)
+	assert.Equal(t, float64(0), report.Samples[0].PacketLoss)
+	assert.InDelta(t, 4.4, report.Samples[0].MOS, 0.05)
+	assert.Equal(t, float64(100), report.Samples[1].Jitter)
+	assert.Equal(t, float64(50), report.Samples[1].PacketLoss)
+	assert.Equal(t, float64(1), report.Samples[1].MOS)
+
+	hep.CID = ""
+	_, err = QualityReportFromHEP(hep)
+	assert.EqualError(t, err, "unable to correlate the RTCP report: missing correlation ID")
+
+	hep.CID = "call-1"
+	hep.Payload = "{"
+	_, err = QualityReportFromHEP(hep)
+	assert.Error(t, err)
+}
+
+func TestEstimateMOS(t *testing.T) {
+	assert.InDelta(t, 4.4, EstimateMOS(0, 0), 0.05)
+	assert.True(t, EstimateMOS(30, 0) < EstimateMOS(10, 0))
+	assert.True(t, EstimateMOS(10, 5) < EstimateMOS(10, 1))
+	assert.InDelta(t, 3.3, EstimateMOS(200, 0), 0.05)
+	assert.Equal(t, float64(1), EstimateMOS(10, 50))
+}
+
+func TestCallQuality(t *testing.T) {
+	var quality *CallQuality
+	assert.Nil(t, quality.Summary())
+	assert.Nil(t, (&CallQuality{}).Summary())
+
+	quality = &CallQuality{}
+	quality.Add(QualitySample{Jitter: 10, PacketLoss: 0, MOS: 4.4})
+	quality.Add(QualitySample{Jitter: 25, PacketLoss: 3, MOS: 3.6})
+	quality.Add(QualitySample{Jitter: 5, PacketLoss: 1, MOS: 4.2})
+	assert.Equal(t, &QualitySummary{
+		Samples:       3,
+		JitterAvg:     13.33,
+		JitterMax:     25,
+		PacketLossAvg: 1.33,
+		PacketLossMax: 3,
+		MOSAvg:        4.07,
+		MOSMin:        3.6,
+	}, quality.Summary())
+}
@@ -1,8 +1,32 @@
 package model
 
+// TransactionSchemaVersion is the version of the begin and end transaction schemas,
+// the major version is incremented on backward incompatible changes
+const TransactionSchemaVersion = "1.3"
+
+// Event is implemented by the messages published to the message bus
+type Event interface {
+	GetTenant() string
+	GetTransactionTag() string
+	GetCSeq() string
+	GetSchemaVersion() string
+}
+
+// MessageID returns the ID of the message of an event with a routing key, distinct for
+// each INVITE of the call: the challenged and redirected INVITEs are retried with the
+// same Call-ID and a new CSeq
+func MessageID(event Event, routingKey string) string {
+	if cseq := event.GetCSeq(); cseq != "" {
+		return event.GetTransactionTag() + ":" + cseq + ":" + routingKey
+	}
+	return event.GetTransactionTag() + ":" + routingKey
+}
+
 // BeginTransaction is the begin transaction message
 type BeginTransaction struct {
-	Request BeginTransactionRequest `json:"request"`
+	SchemaVersion string                  `json:"schema_version" jsonschema:"pattern=^1\\.[0-9]+$"`
+	Request       BeginTransactionRequest `json:"request"`
+	CSeq          string                  `json:"-"`
 }
 
 // BeginTransactionRequest is the begin transaction request object
@@ -13,21 +37,70 @@ type BeginTransactionRequest struct {
 	DestinationAccountTag string   `json:"destination_account_tag"`
 	Source                string   `json:"source"`
 	Destination           string   `json:"destination"`
+	CaptureAgentID        uint32   `json:"capture_agent_id,omitempty"`
+	CaptureAgentName      string   `json:"capture_agent_name,omitempty"`
+	Direction             string   `json:"direction,omitempty" jsonschema:"enum=ingress,enum=egress,enum=internal"`
 	ProductTag            string   `json:"product_tag,omitempty"`
 	Tags                  []string `json:"tags,omitempty"`
-	TimestampBegin        string   `json:"timestamp_begin"`
+	TimestampBegin        string   `json:"timestamp_begin" jsonschema:"format=date-time"`
 }
 
 // EndTransaction is the begin transaction message
 type EndTransaction struct {
-	Request EndTransactionRequest `json:"request"`
+	SchemaVersion string                `json:"schema_version" jsonschema:"pattern=^1\\.[0-9]+$"`
+	Request       EndTransactionRequest `json:"request"`
+	CSeq          string                `json:"-"`
 }
 
 // EndTransactionRequest is the begin transaction request object
 type EndTransactionRequest struct {
-	Tenant                string `json:"tenant"`
-	TransactionTag        string `json:"transaction_tag"`
-	AccountTag            string `json:"account_tag"`
-	DestinationAccountTag string `json:"destination_account_tag"`
-	TimestampEnd          string `json:"timestamp_end"`
+	Tenant                string          `json:"tenant"`
+	TransactionTag        string          `json:"transaction_tag"`
+	AccountTag            string          `json:"account_tag"`
+	DestinationAccountTag string          `json:"destination_account_tag"`
+	CaptureAgentID        uint32          `json:"capture_agent_id,omitempty"`
+	CaptureAgentName      string          `json:"capture_agent_name,omitempty"`
+	Direction             string          `json:"direction,omitempty" jsonschema:"enum=ingress,enum=egress,enum=internal"`
+	TimestampEnd          string          `json:"timestamp_end" jsonschema:"format=date-time"`
+	Quality               *QualitySummary `json:"quality,omitempty"`
+}
+
+// GetTenant returns the tenant of the transaction
+func (t *BeginTransaction) GetTenant() string {
+	return t.Request.Tenant
+}
+
+// GetTransactionTag returns the transaction tag, that is the SIP Call-ID
+func (t *BeginTransaction) GetTransactionTag() string {
+	return t.Request.TransactionTag
+}
+
+// GetCSeq returns the CSeq number of the INVITE of the call, not published
+func (t *BeginTransaction) GetCSeq() string {
+	return t.CSeq
+}
+
+// GetSchemaVersion returns the version of the schema of the message
+func (t *BeginTransaction) GetSchemaVersion() string {
+	return t.SchemaVersion
+}
+
+// GetTenant returns the tenant of the transaction
+func (t *EndTransaction) GetTenant() string {
+	return t.Request.Tenant
+}
+
+// GetTransactionTag returns the transaction tag, that is the SIP Call-ID
+func (t *EndTransaction) GetTransactionTag() string {
+	return t.Request.TransactionTag
+}
+
+// GetCSeq returns the CSeq number of the INVITE of the call, not published
+func (t *EndTransaction) GetCSeq() string {
+	return t.CSeq
+}
+
+// GetSchemaVersion returns the version of the schema of the message
+func (t *EndTransaction) GetSchemaVersion() string {
+	return t.SchemaVersion
 }
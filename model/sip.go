@@ -2,26 +2,74 @@ package model
 
 import (
 	"regexp"
+	"strconv"
 	"time"
 
-	"github.com/mendersoftware/go-lib-micro/config"
-
 	dconfig "github.com/canyanio/rating-agent-hep/config"
 	"github.com/sipcapture/heplify-server/decoder"
 	"github.com/sipcapture/heplify-server/sipparser"
 )
 
+// Directions of the SIP messages, relative to the SIP addresses of the platform
+const (
+	DirectionIngress  = dconfig.DirectionIngress
+	DirectionEgress   = dconfig.DirectionEgress
+	DirectionInternal = dconfig.DirectionInternal
+)
+
 // SIPMessage represents a SIP message extracted from an HEP message
 type SIPMessage struct {
 	*sipparser.SipMsg
 	AccountTag            string
 	DestinationAccountTag string
 	Timestamp             time.Time
+	SourceIP              string
+	SourcePort            uint32
+	DestinationIP         string
+	DestinationPort       uint32
+	CaptureAgentID        uint32
+	CaptureAgentName      string
+	Direction             string
+}
+
+// SIPMessageFromHEP returns a HEPMessage from a decoded HEP packet, applying the
+// settings of its capture agent
+func SIPMessageFromHEP(hep *decoder.HEP, settings *dconfig.SIPSettings) *SIPMessage {
+	msg := parseSIPMessage(hep.Payload, hep.Timestamp, settings.ForCaptureAgent(hep.NodeID))
+	msg.SourceIP = hep.SrcIP
+	msg.SourcePort = hep.SrcPort
+	msg.DestinationIP = hep.DstIP
+	msg.DestinationPort = hep.DstPort
+	msg.CaptureAgentID = hep.NodeID
+	// the decoder defaults the node name to the node ID
+	if hep.NodeName != strconv.FormatUint(uint64(hep.NodeID), 10) {
+		msg.CaptureAgentName = hep.NodeName
+	}
+	if agent := settings.CaptureAgent(hep.NodeID); agent != nil && agent.Name != "" {
+		msg.CaptureAgentName = agent.Name
+	}
+	msg.Direction = messageDirection(msg, settings.AddressesFor(hep.NodeID))
+	return msg
 }
 
-// SIPMessageFromHEP returns a HEPMessage from a decoded HEP packet
-func SIPMessageFromHEP(hep *decoder.HEP) *SIPMessage {
-	return parseSIPMessage(hep.Payload, hep.Timestamp)
+// messageDirection returns the direction of a message relative to some addresses,
+// empty if neither its source nor its destination is one of them; the responses
+// have the direction of their request
+func messageDirection(msg *SIPMessage, addresses []string) string {
+	source := stringInSlice(msg.SourceIP, addresses)
+	destination := stringInSlice(msg.DestinationIP, addresses)
+	if msg.FirstMethod == "" {
+		source, destination = destination, source
+	}
+	switch {
+	case source && destination:
+		return DirectionInternal
+	case destination:
+		return DirectionIngress
+	case source:
+		return DirectionEgress
+	}
+	return ""
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -33,19 +81,14 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func parseSIPMessage(payload string, timestamp time.Time) *SIPMessage {
-	sipHeaderCaller := config.Config.GetString(dconfig.SettingSIPHeaderCaller)
-	sipHeaderCallee := config.Config.GetString(dconfig.SettingSIPHeaderCallee)
-	sipLocalDomains := config.Config.GetStringSlice(dconfig.SettingSIPLocalDomains)
-	accountTagMatchRegexp := config.Config.GetString(dconfig.SettingAccountTagMatchRegexp)
-	sipHeaderHistoryInfo := config.Config.GetString(dconfig.SettingSIPHeaderHistoryInfo)
-	sipHeaderHistoryInfoIndex := config.Config.GetInt(dconfig.SettingSIPHeaderHistoryInfoIndex)
-	return parseSIPMessageWithSettings(payload, timestamp, sipHeaderCaller, sipHeaderCallee, sipHeaderHistoryInfo,
-		sipHeaderHistoryInfoIndex, sipLocalDomains, accountTagMatchRegexp)
-}
+func parseSIPMessage(payload string, timestamp time.Time, settings *dconfig.SIPSettings) *SIPMessage {
+	sipHeaderCaller := settings.HeaderCaller
+	sipHeaderCallee := settings.HeaderCallee
+	sipHeaderHistoryInfo := settings.HeaderHistoryInfo
+	sipHeaderHistoryInfoIndex := settings.HeaderHistoryInfoIndex
+	sipLocalDomains := settings.LocalDomains
+	accountTagMatchRegexp := settings.AccountTagMatchRegexp
 
-func parseSIPMessageWithSettings(payload string, timestamp time.Time, sipHeaderCaller string, sipHeaderCallee string,
-	sipHeaderHistoryInfo string, sipHeaderHistoryInfoIndex int, sipLocalDomains []string, accountTagMatchRegexp string) *SIPMessage {
 	customHeaders := []string{}
 	if sipHeaderCaller != "" {
 		customHeaders = append(customHeaders, sipHeaderCaller)
@@ -6,6 +6,8 @@ import (
 
 	"github.com/sipcapture/heplify-server/decoder"
 	"github.com/stretchr/testify/assert"
+
+	dconfig "github.com/canyanio/rating-agent-hep/config"
 )
 
 func TestParseSIPMessage(t *testing.T) {
@@ -25,7 +27,7 @@ func TestParseSIPMessage(t *testing.T) {
 		"Content-Type: application/sdp\r\n" +
 		"Content-Length: 0\r\n"
 	hep := &decoder.HEP{Payload: payload}
-	msg := SIPMessageFromHEP(hep)
+	msg := SIPMessageFromHEP(hep, &dconfig.SIPSettings{})
 
 	assert.NotNil(t, msg)
 
@@ -243,12 +245,108 @@ func TestParseSIPMessageWithSettings(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		msg := parseSIPMessageWithSettings(test.payload, time.Now(),
-			test.sipHeaderCaller, test.sipHeaderCallee, test.sipHeaderHistoryInfo,
-			test.sipHeaderHistoryInfoIndex, test.sipLocalDomains, test.accountTagMatchRegexp)
+		msg := parseSIPMessage(test.payload, time.Now(), &dconfig.SIPSettings{
+			HeaderCaller:           test.sipHeaderCaller,
+			HeaderCallee:           test.sipHeaderCallee,
+			HeaderHistoryInfo:      test.sipHeaderHistoryInfo,
+			HeaderHistoryInfoIndex: test.sipHeaderHistoryInfoIndex,
+			LocalDomains:           test.sipLocalDomains,
+			AccountTagMatchRegexp:  test.accountTagMatchRegexp,
+		})
 		assert.NotNil(t, msg)
 
 		assert.Equal(t, test.accountTag, msg.AccountTag)
 		assert.Equal(t, test.destinationAccountTag, msg.DestinationAccountTag)
 	}
 }
+
+func TestSIPMessageFromHEPCaptureAgent(t *testing.T) {
+	invite := "INVITE sip:1001@sip.canyan.io SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK-1\r\n" +
+		"From: <sip:1000@sip.canyan.io>;tag=1\r\n" +
+		"To: <sip:1001@sip.canyan.io>\r\n" +
+		"Call-ID: call-1\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	ok := "SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK-1\r\n" +
+		"From: <sip:1000@sip.canyan.io>;tag=1\r\n" +
+		"To: <sip:1001@sip.canyan.io>;tag=2\r\n" +
+		"Call-ID: call-1\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	settings := &dconfig.SIPSettings{
+		CaptureAgents: []dconfig.CaptureAgentSettings{
+			{ID: 2001, Name: "edge-proxy", LocalDomains: []string{"sip.canyan.io"}, Addresses: []string{"10.0.0.1"}},
+		},
+	}
+
+	// the node name defaults to the node ID in the decoder
+	msg := SIPMessageFromHEP(&decoder.HEP{Payload: invite, NodeID: 2002, NodeName: "2002",
+		SrcIP: "10.0.0.2", SrcPort: 5060, DstIP: "10.0.0.1", DstPort: 5080}, settings)
+	assert.Equal(t, uint32(2002), msg.CaptureAgentID)
+	assert.Equal(t, "", msg.CaptureAgentName)
+	assert.Equal(t, uint32(5060), msg.SourcePort)
+	assert.Equal(t, uint32(5080), msg.DestinationPort)
+	assert.Equal(t, "", msg.AccountTag)
+	assert.Equal(t, "", msg.Direction)
+
+	msg = SIPMessageFromHEP(&decoder.HEP{Payload: invite, NodeID: 2002, NodeName: "sbc"}, settings)
+	assert.Equal(t, "sbc", msg.CaptureAgentName)
+
+	// the settings of the agent replace the local domains and the node name
+	var tests = []struct {
+		payload   string
+		src, dst  string
+		direction string
+	}{
+		{invite, "10.0.0.2", "10.0.0.1", DirectionIngress},
+		{invite, "10.0.0.1", "10.0.0.3", DirectionEgress},
+		{invite, "10.0.0.1", "10.0.0.1", DirectionInternal},
+		{invite, "10.0.0.2", "10.0.0.3", ""},
+		{ok, "10.0.0.1", "10.0.0.2", DirectionIngress},
+		{ok, "10.0.0.3", "10.0.0.1", DirectionEgress},
+	}
+	for _, test := range tests {
+		msg = SIPMessageFromHEP(&decoder.HEP{Payload: test.payload, NodeID: 2001, NodeName: "node",
+			SrcIP: test.src, DstIP: test.dst}, settings)
+		assert.Equal(t, "edge-proxy", msg.CaptureAgentName)
+		assert.Equal(t, "1000", msg.AccountTag)
+		assert.Equal(t, test.direction, msg.Direction, test.src+" -> "+test.dst)
+	}
+}
+
+func TestSIPMessageFromHEPDirection(t *testing.T) {
+	invite := "INVITE sip:1001@sip.canyan.io SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK-1\r\n" +
+		"From: <sip:1000@sip.canyan.io>;tag=1\r\n" +
+		"To: <sip:1001@sip.canyan.io>\r\n" +
+		"Call-ID: call-1\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	settings := &dconfig.SIPSettings{
+		Addresses: []string{"10.0.0.1"},
+		CaptureAgents: []dconfig.CaptureAgentSettings{
+			{ID: 2001, Addresses: []string{"10.0.0.3"}},
+		},
+	}
+
+	// the addresses of the agents extend the ones of the platform
+	var tests = []struct {
+		nodeID    uint32
+		src, dst  string
+		direction string
+	}{
+		{2001, "10.0.0.2", "10.0.0.1", DirectionIngress},
+		{2001, "10.0.0.1", "10.0.0.3", DirectionInternal},
+		{2001, "10.0.0.3", "10.0.0.2", DirectionEgress},
+		{2002, "10.0.0.2", "10.0.0.1", DirectionIngress},
+		{2002, "10.0.0.1", "10.0.0.3", DirectionEgress},
+		{2002, "10.0.0.3", "10.0.0.2", ""},
+	}
+	for _, test := range tests {
+		msg := SIPMessageFromHEP(&decoder.HEP{Payload: invite, NodeID: test.nodeID,
+			SrcIP: test.src, DstIP: test.dst}, settings)
+		assert.Equal(t, test.direction, msg.Direction, test.src+" -> "+test.dst)
+	}
+}
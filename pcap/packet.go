@@ -0,0 +1,202 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Link types of the supported capture files
+const (
+	LinkTypeNull      = 0
+	LinkTypeEthernet  = 1
+	LinkTypeRaw       = 101
+	LinkTypeLoop      = 108
+	LinkTypeLinuxSLL  = 113
+	LinkTypeIPv4      = 228
+	LinkTypeIPv6      = 229
+	LinkTypeLinuxSLL2 = 276
+)
+
+const (
+	etherTypeIPv4   = 0x0800
+	etherTypeIPv6   = 0x86dd
+	etherTypeVLAN   = 0x8100
+	etherTypeQinQ   = 0x88a8
+	ipProtocolUDP   = 17
+	ipv6HopByHop    = 0
+	ipv6Routing     = 43
+	ipv6Fragment    = 44
+	ipv6Destination = 60
+)
+
+var errNotUDP = errors.New("not an UDP packet")
+
+// Packet is an UDP packet read from a capture file
+type Packet struct {
+	Timestamp time.Time
+	SrcIP     net.IP
+	DstIP     net.IP
+	SrcPort   uint16
+	DstPort   uint16
+	Payload   []byte
+}
+
+// SrcAddr returns the source address of the packet
+func (p *Packet) SrcAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: p.SrcIP, Port: int(p.SrcPort)}
+}
+
+// DstAddr returns the destination address of the packet
+func (p *Packet) DstAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: p.DstIP, Port: int(p.DstPort)}
+}
+
+func decodeLinkLayer(linkType uint32, data []byte) (*Packet, error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, errors.New("truncated ethernet frame")
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return nil, errors.New("truncated VLAN tag")
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		return decodeEtherType(etherType, data)
+
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, errors.New("truncated linux cooked capture header")
+		}
+		return decodeEtherType(binary.BigEndian.Uint16(data[14:16]), data[16:])
+
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, errors.New("truncated linux cooked capture header")
+		}
+		return decodeEtherType(binary.BigEndian.Uint16(data[0:2]), data[20:])
+
+	case LinkTypeNull, LinkTypeLoop:
+		if len(data) < 4 {
+			return nil, errors.New("truncated loopback header")
+		}
+		// the address family is in host byte order for the null link type
+		family := binary.LittleEndian.Uint32(data[0:4])
+		if linkType == LinkTypeLoop || family > 0xffff {
+			family = binary.BigEndian.Uint32(data[0:4])
+		}
+		switch family {
+		case 2:
+			return decodeIPv4(data[4:])
+		case 10, 24, 28, 30:
+			return decodeIPv6(data[4:])
+		}
+		return nil, errors.Errorf("unsupported address family: %d", family)
+
+	case LinkTypeRaw:
+		if len(data) < 1 {
+			return nil, errors.New("truncated IP packet")
+		}
+		if data[0]>>4 == 6 {
+			return decodeIPv6(data)
+		}
+		return decodeIPv4(data)
+
+	case LinkTypeIPv4:
+		return decodeIPv4(data)
+
+	case LinkTypeIPv6:
+		return decodeIPv6(data)
+	}
+	return nil, errors.Errorf("unsupported link type: %d", linkType)
+}
+
+func decodeEtherType(etherType uint16, data []byte) (*Packet, error) {
+	switch etherType {
+	case etherTypeIPv4:
+		return decodeIPv4(data)
+	case etherTypeIPv6:
+		return decodeIPv6(data)
+	}
+	return nil, errors.Errorf("unsupported ether type: 0x%04x", etherType)
+}
+
+func decodeIPv4(data []byte) (*Packet, error) {
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return nil, errors.New("invalid IPv4 packet")
+	}
+	headerLength := int(data[0]&0x0f) * 4
+	totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+	if headerLength < 20 || totalLength < headerLength || len(data) < headerLength {
+		return nil, errors.New("invalid IPv4 packet")
+	}
+	if totalLength < len(data) {
+		data = data[:totalLength]
+	}
+	// fragmented datagrams are not reassembled
+	if flags := binary.BigEndian.Uint16(data[6:8]); flags&0x2000 != 0 || flags&0x1fff != 0 {
+		return nil, errors.New("fragmented IPv4 packet")
+	}
+	if data[9] != ipProtocolUDP {
+		return nil, errNotUDP
+	}
+	return decodeUDP(net.IP(data[12:16]), net.IP(data[16:20]), data[headerLength:])
+}
+
+func decodeIPv6(data []byte) (*Packet, error) {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return nil, errors.New("invalid IPv6 packet")
+	}
+	payloadLength := int(binary.BigEndian.Uint16(data[4:6]))
+	nextHeader := data[6]
+	srcIP := net.IP(data[8:24])
+	dstIP := net.IP(data[24:40])
+	data = data[40:]
+	if payloadLength < len(data) {
+		data = data[:payloadLength]
+	}
+	for {
+		switch nextHeader {
+		case ipProtocolUDP:
+			return decodeUDP(srcIP, dstIP, data)
+		case ipv6HopByHop, ipv6Routing, ipv6Destination:
+			if len(data) < 8 {
+				return nil, errors.New("truncated IPv6 extension header")
+			}
+			length := (int(data[1]) + 1) * 8
+			if len(data) < length {
+				return nil, errors.New("truncated IPv6 extension header")
+			}
+			nextHeader = data[0]
+			data = data[length:]
+		case ipv6Fragment:
+			return nil, errors.New("fragmented IPv6 packet")
+		default:
+			return nil, errNotUDP
+		}
+	}
+}
+
+func decodeUDP(srcIP, dstIP net.IP, data []byte) (*Packet, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated UDP header")
+	}
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	if length < 8 || length > len(data) {
+		return nil, errors.New("invalid UDP length")
+	}
+	return &Packet{
+		SrcIP:   append(net.IP{}, srcIP...),
+		DstIP:   append(net.IP{}, dstIP...),
+		SrcPort: binary.BigEndian.Uint16(data[0:2]),
+		DstPort: binary.BigEndian.Uint16(data[2:4]),
+		Payload: data[8:length],
+	}, nil
+}
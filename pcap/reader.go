@@ -0,0 +1,287 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Magic numbers of the supported capture file formats
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	magicNG           = 0x0a0d0d0a
+	magicNGByteOrder  = 0x1a2b3c4d
+)
+
+// pcapng block types
+const (
+	blockTypeInterfaceDescription = 0x00000001
+	blockTypePacket               = 0x00000002
+	blockTypeSimplePacket         = 0x00000003
+	blockTypeEnhancedPacket       = 0x00000006
+	blockTypeSectionHeader        = magicNG
+)
+
+const (
+	optionEndOfOpt = 0
+	optionTSResol  = 9
+)
+
+const maxBlockLength = 16 * 1024 * 1024
+
+// Reader reads the UDP packets from a pcap or pcapng capture file
+type Reader struct {
+	r          *bufio.Reader
+	ng         bool
+	byteOrder  binary.ByteOrder
+	linkType   uint32
+	resolution time.Duration
+	interfaces []ngInterface
+}
+
+type ngInterface struct {
+	linkType uint32
+	snapLen  uint32
+	units    uint64
+}
+
+// NewReader returns a new Reader, detecting the file format from its header
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{
+		r: bufio.NewReader(r),
+	}
+
+	header, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the capture file header")
+	}
+
+	if binary.LittleEndian.Uint32(header) == magicNG {
+		reader.ng = true
+		return reader, nil
+	}
+
+	for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch byteOrder.Uint32(header) {
+		case magicMicroseconds:
+			reader.resolution = time.Microsecond
+		case magicNanoseconds:
+			reader.resolution = time.Nanosecond
+		default:
+			continue
+		}
+		reader.byteOrder = byteOrder
+		break
+	}
+	if reader.byteOrder == nil {
+		return nil, errors.New("unknown capture file format")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := io.ReadFull(reader.r, buf); err != nil {
+		return nil, errors.Wrap(err, "unable to read the capture file header")
+	}
+	reader.linkType = reader.byteOrder.Uint32(buf[20:24]) & 0x0fffffff
+
+	return reader, nil
+}
+
+// Next returns the next UDP packet, skipping the packets which cannot be decoded;
+// it returns io.EOF when there are no more packets
+func (r *Reader) Next() (*Packet, error) {
+	for {
+		data, linkType, timestamp, err := r.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		packet, err := decodeLinkLayer(linkType, data)
+		if err != nil {
+			continue
+		}
+		packet.Timestamp = timestamp
+		return packet, nil
+	}
+}
+
+func (r *Reader) readRecord() ([]byte, uint32, time.Time, error) {
+	if r.ng {
+		return r.readBlock()
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.Wrap(err, "truncated packet header")
+		}
+		return nil, 0, time.Time{}, err
+	}
+	sec := r.byteOrder.Uint32(header[0:4])
+	frac := r.byteOrder.Uint32(header[4:8])
+	capLen := r.byteOrder.Uint32(header[8:12])
+	if capLen > maxBlockLength {
+		return nil, 0, time.Time{}, errors.Errorf("invalid packet length: %d", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, 0, time.Time{}, errors.Wrap(err, "truncated packet")
+	}
+
+	timestamp := time.Unix(int64(sec), int64(frac)*int64(r.resolution))
+	return data, r.linkType, timestamp, nil
+}
+
+func (r *Reader) readBlock() ([]byte, uint32, time.Time, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.Wrap(err, "truncated block header")
+		}
+		return nil, 0, time.Time{}, err
+	}
+
+	blockType := binary.LittleEndian.Uint32(header[0:4])
+	if blockType == blockTypeSectionHeader {
+		// the byte order is defined by the section header block itself
+		magic, err := r.r.Peek(4)
+		if err != nil {
+			return nil, 0, time.Time{}, errors.Wrap(err, "truncated section header block")
+		}
+		if binary.LittleEndian.Uint32(magic) == magicNGByteOrder {
+			r.byteOrder = binary.LittleEndian
+		} else if binary.BigEndian.Uint32(magic) == magicNGByteOrder {
+			r.byteOrder = binary.BigEndian
+		} else {
+			return nil, 0, time.Time{}, errors.New("invalid section header block")
+		}
+		r.interfaces = nil
+	} else if r.byteOrder == nil {
+		return nil, 0, time.Time{}, errors.New("missing section header block")
+	}
+	blockType = r.byteOrder.Uint32(header[0:4])
+
+	length := r.byteOrder.Uint32(header[4:8])
+	if length < 12 || length%4 != 0 || length > maxBlockLength {
+		return nil, 0, time.Time{}, errors.Errorf("invalid block length: %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, 0, time.Time{}, errors.Wrap(err, "truncated block")
+	}
+	body = body[:len(body)-4]
+
+	switch blockType {
+	case blockTypeInterfaceDescription:
+		return nil, 0, time.Time{}, r.readInterfaceDescription(body)
+
+	case blockTypeEnhancedPacket:
+		if len(body) < 20 {
+			return nil, 0, time.Time{}, errors.New("invalid enhanced packet block")
+		}
+		iface, err := r.getInterface(r.byteOrder.Uint32(body[0:4]))
+		if err != nil {
+			return nil, 0, time.Time{}, err
+		}
+		ts := uint64(r.byteOrder.Uint32(body[4:8]))<<32 | uint64(r.byteOrder.Uint32(body[8:12]))
+		capLen := r.byteOrder.Uint32(body[12:16])
+		if int(capLen) > len(body)-20 {
+			return nil, 0, time.Time{}, errors.New("invalid enhanced packet block")
+		}
+		return body[20 : 20+capLen], iface.linkType, iface.timestamp(ts), nil
+
+	case blockTypePacket:
+		if len(body) < 20 {
+			return nil, 0, time.Time{}, errors.New("invalid packet block")
+		}
+		iface, err := r.getInterface(uint32(r.byteOrder.Uint16(body[0:2])))
+		if err != nil {
+			return nil, 0, time.Time{}, err
+		}
+		ts := uint64(r.byteOrder.Uint32(body[4:8]))<<32 | uint64(r.byteOrder.Uint32(body[8:12]))
+		capLen := r.byteOrder.Uint32(body[12:16])
+		if int(capLen) > len(body)-20 {
+			return nil, 0, time.Time{}, errors.New("invalid packet block")
+		}
+		return body[20 : 20+capLen], iface.linkType, iface.timestamp(ts), nil
+
+	case blockTypeSimplePacket:
+		if len(body) < 4 {
+			return nil, 0, time.Time{}, errors.New("invalid simple packet block")
+		}
+		iface, err := r.getInterface(0)
+		if err != nil {
+			return nil, 0, time.Time{}, err
+		}
+		capLen := r.byteOrder.Uint32(body[0:4])
+		if iface.snapLen > 0 && capLen > iface.snapLen {
+			capLen = iface.snapLen
+		}
+		if int(capLen) > len(body)-4 {
+			return nil, 0, time.Time{}, errors.New("invalid simple packet block")
+		}
+		// simple packet blocks do not carry any timestamp
+		return body[4 : 4+capLen], iface.linkType, time.Time{}, nil
+	}
+
+	// other blocks (statistics, name resolution, ...) are ignored
+	return nil, 0, time.Time{}, nil
+}
+
+func (r *Reader) readInterfaceDescription(body []byte) error {
+	if len(body) < 8 {
+		return errors.New("invalid interface description block")
+	}
+	iface := ngInterface{
+		linkType: uint32(r.byteOrder.Uint16(body[0:2])),
+		snapLen:  r.byteOrder.Uint32(body[4:8]),
+		units:    1000000,
+	}
+
+	options := body[8:]
+	for len(options) >= 4 {
+		code := r.byteOrder.Uint16(options[0:2])
+		length := int(r.byteOrder.Uint16(options[2:4]))
+		if code == optionEndOfOpt || len(options) < 4+length {
+			break
+		}
+		if code == optionTSResol && length >= 1 {
+			resolution := options[4]
+			units := uint64(1)
+			for i := 0; i < int(resolution&0x7f); i++ {
+				if resolution&0x80 != 0 {
+					units *= 2
+				} else {
+					units *= 10
+				}
+			}
+			iface.units = units
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+
+	r.interfaces = append(r.interfaces, iface)
+	return nil
+}
+
+func (r *Reader) getInterface(id uint32) (*ngInterface, error) {
+	if int(id) >= len(r.interfaces) {
+		return nil, errors.Errorf("unknown interface: %d", id)
+	}
+	return &r.interfaces[id], nil
+}
+
+func (i *ngInterface) timestamp(ts uint64) time.Time {
+	sec := ts / i.units
+	frac := ts % i.units
+	if i.units <= uint64(time.Second) {
+		return time.Unix(int64(sec), int64(frac*uint64(time.Second)/i.units))
+	}
+	return time.Unix(int64(sec), int64(float64(frac)*float64(time.Second)/float64(i.units)))
+}
@@ -0,0 +1,248 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func udpIPv4(src, dst string, srcPort, dstPort uint16, payload []byte) []byte {
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[0:2], srcPort)
+	binary.BigEndian.PutUint16(udp[2:4], dstPort)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(udp)))
+	ip[8] = 64
+	ip[9] = ipProtocolUDP
+	copy(ip[12:16], net.ParseIP(src).To4())
+	copy(ip[16:20], net.ParseIP(dst).To4())
+	return append(ip, udp...)
+}
+
+func udpIPv6(src, dst string, srcPort, dstPort uint16, payload []byte) []byte {
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[0:2], srcPort)
+	binary.BigEndian.PutUint16(udp[2:4], dstPort)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(udp)))
+	ip[6] = ipProtocolUDP
+	ip[7] = 64
+	copy(ip[8:24], net.ParseIP(src).To16())
+	copy(ip[24:40], net.ParseIP(dst).To16())
+	return append(ip, udp...)
+}
+
+func ethernet(etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 14)
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+	return append(frame, payload...)
+}
+
+func pcapFile(byteOrder binary.ByteOrder, magic uint32, linkType uint32, timestamps []time.Time, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, byteOrder, []uint32{magic, 0x00040002, 0, 0, 65535, linkType})
+	for i, frame := range frames {
+		frac := timestamps[i].Nanosecond() / 1000
+		if magic == magicNanoseconds {
+			frac = timestamps[i].Nanosecond()
+		}
+		binary.Write(buf, byteOrder, []uint32{uint32(timestamps[i].Unix()), uint32(frac), uint32(len(frame)), uint32(len(frame))})
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func pcapNGBlock(byteOrder binary.ByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	buf := &bytes.Buffer{}
+	binary.Write(buf, byteOrder, []uint32{blockType, uint32(12 + len(body))})
+	buf.Write(body)
+	binary.Write(buf, byteOrder, uint32(12+len(body)))
+	return buf.Bytes()
+}
+
+func pcapNGFile(byteOrder binary.ByteOrder, linkType uint16, timestamps []time.Time, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+
+	shb := &bytes.Buffer{}
+	binary.Write(shb, byteOrder, uint32(magicNGByteOrder))
+	binary.Write(shb, byteOrder, []uint16{1, 0})
+	binary.Write(shb, byteOrder, int64(-1))
+	buf.Write(pcapNGBlock(byteOrder, blockTypeSectionHeader, shb.Bytes()))
+
+	// interface with nanoseconds resolution
+	idb := &bytes.Buffer{}
+	binary.Write(idb, byteOrder, []uint16{linkType, 0})
+	binary.Write(idb, byteOrder, uint32(0))
+	binary.Write(idb, byteOrder, []uint16{optionTSResol, 1})
+	idb.Write([]byte{9, 0, 0, 0})
+	binary.Write(idb, byteOrder, []uint16{optionEndOfOpt, 0})
+	buf.Write(pcapNGBlock(byteOrder, blockTypeInterfaceDescription, idb.Bytes()))
+
+	// unknown blocks are skipped
+	buf.Write(pcapNGBlock(byteOrder, 0x00000005, []byte{0, 0, 0, 0}))
+
+	for i, frame := range frames {
+		ts := uint64(timestamps[i].UnixNano())
+		epb := &bytes.Buffer{}
+		binary.Write(epb, byteOrder, []uint32{0, uint32(ts >> 32), uint32(ts), uint32(len(frame)), uint32(len(frame))})
+		epb.Write(frame)
+		buf.Write(pcapNGBlock(byteOrder, blockTypeEnhancedPacket, epb.Bytes()))
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, data []byte) []*Packet {
+	packets := []*Packet{}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	if err != nil {
+		return packets
+	}
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+func TestNewReaderInvalid(t *testing.T) {
+	reader, err := NewReader(bytes.NewReader([]byte{}))
+	assert.Error(t, err)
+	assert.Nil(t, reader)
+
+	reader, err = NewReader(bytes.NewReader([]byte("DUMMY DUMMY DUMMY DUMMY DUMMY")))
+	assert.Error(t, err)
+	assert.Nil(t, reader)
+}
+
+func TestReaderPcap(t *testing.T) {
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 622171000, time.UTC)
+	timestamps := []time.Time{ts, ts.Add(time.Second), ts.Add(2 * time.Second)}
+	frames := [][]byte{
+		ethernet(etherTypeIPv4, udpIPv4("192.168.192.2", "192.168.192.5", 5060, 9060, []byte("FIRST"))),
+		// VLAN tagged frame
+		append([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x81, 0x00, 0x00, 0x01},
+			ethernet(etherTypeIPv6, udpIPv6("2001:db8::1", "2001:db8::2", 5060, 5080, []byte("SECOND")))[12:]...),
+		// ARP frames are skipped
+		ethernet(0x0806, make([]byte, 28)),
+	}
+
+	for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, magic := range []uint32{magicMicroseconds, magicNanoseconds} {
+			packets := readAll(t, pcapFile(byteOrder, magic, LinkTypeEthernet, timestamps, frames))
+			assert.Len(t, packets, 2)
+
+			assert.True(t, ts.Equal(packets[0].Timestamp))
+			assert.Equal(t, "192.168.192.2:5060", packets[0].SrcAddr().String())
+			assert.Equal(t, "192.168.192.5:9060", packets[0].DstAddr().String())
+			assert.Equal(t, []byte("FIRST"), packets[0].Payload)
+
+			assert.True(t, ts.Add(time.Second).Equal(packets[1].Timestamp))
+			assert.Equal(t, "[2001:db8::1]:5060", packets[1].SrcAddr().String())
+			assert.Equal(t, "[2001:db8::2]:5080", packets[1].DstAddr().String())
+			assert.Equal(t, []byte("SECOND"), packets[1].Payload)
+		}
+	}
+}
+
+func TestReaderPcapLinkTypes(t *testing.T) {
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	payload := udpIPv4("192.168.192.2", "192.168.192.5", 5060, 9060, []byte("PAYLOAD"))
+
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[14:16], etherTypeIPv4)
+
+	var tests = []struct {
+		linkType uint32
+		frame    []byte
+	}{
+		{LinkTypeRaw, payload},
+		{LinkTypeIPv4, payload},
+		{LinkTypeNull, append([]byte{2, 0, 0, 0}, payload...)},
+		{LinkTypeLoop, append([]byte{0, 0, 0, 2}, payload...)},
+		{LinkTypeLinuxSLL, append(sll, payload...)},
+	}
+
+	for _, test := range tests {
+		packets := readAll(t, pcapFile(binary.LittleEndian, magicMicroseconds, test.linkType,
+			[]time.Time{ts}, [][]byte{test.frame}))
+		assert.Len(t, packets, 1, test.linkType)
+		if len(packets) == 1 {
+			assert.Equal(t, []byte("PAYLOAD"), packets[0].Payload)
+		}
+	}
+}
+
+func TestReaderPcapNG(t *testing.T) {
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 622171123, time.UTC)
+	timestamps := []time.Time{ts, ts.Add(time.Second)}
+	frames := [][]byte{
+		ethernet(etherTypeIPv4, udpIPv4("192.168.192.2", "192.168.192.5", 5060, 9060, []byte("FIRST"))),
+		ethernet(etherTypeIPv4, udpIPv4("192.168.192.5", "192.168.192.2", 9060, 5060, []byte("SECOND"))),
+	}
+
+	for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		packets := readAll(t, pcapNGFile(byteOrder, LinkTypeEthernet, timestamps, frames))
+		assert.Len(t, packets, 2)
+
+		assert.True(t, ts.Equal(packets[0].Timestamp))
+		assert.Equal(t, []byte("FIRST"), packets[0].Payload)
+		assert.True(t, ts.Add(time.Second).Equal(packets[1].Timestamp))
+		assert.Equal(t, "192.168.192.5:9060", packets[1].SrcAddr().String())
+		assert.Equal(t, []byte("SECOND"), packets[1].Payload)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	frame := ethernet(etherTypeIPv4, udpIPv4("192.168.192.2", "192.168.192.5", 5060, 9060, []byte("PAYLOAD")))
+	data := pcapFile(binary.LittleEndian, magicMicroseconds, LinkTypeEthernet, []time.Time{ts}, [][]byte{frame})
+
+	reader, err := NewReader(bytes.NewReader(data[:len(data)-2]))
+	assert.Nil(t, err)
+
+	packet, err := reader.Next()
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+	assert.Nil(t, packet)
+}
+
+func TestReaderTestdata(t *testing.T) {
+	cwd, _ := os.Getwd()
+
+	for _, name := range []string{"hep.pcap", "sip.pcapng"} {
+		data, err := ioutil.ReadFile(filepath.Join(cwd, "..", "testdata", name))
+		assert.Nil(t, err)
+
+		packets := readAll(t, data)
+		assert.Len(t, packets, 3, name)
+	}
+}
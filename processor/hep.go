@@ -1,32 +1,93 @@
 package processor
 
 import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
 	"github.com/sipcapture/heplify-server/decoder"
 
+	"github.com/canyanio/rating-agent-hep/config"
 	"github.com/canyanio/rating-agent-hep/model"
 )
 
 // HEPProcessorInterface is the interface for Server objects
 type HEPProcessorInterface interface {
-	Process(packet []byte) (*model.SIPMessage, error)
+	Process(packet []byte) (*model.SIPMessage, *model.QualityReport, error)
+	ProcessSIP(packet []byte, timestamp time.Time, src, dst *net.UDPAddr) (*model.SIPMessage, error)
+	SetSettings(settings *config.SIPSettings)
 }
 
 // HEPProcessor is the HEP processor
 type HEPProcessor struct {
+	settings atomic.Value
 }
 
 // NewHEPProcessor initializes a new HEP processor
-func NewHEPProcessor() *HEPProcessor {
-	return &HEPProcessor{}
+func NewHEPProcessor(settings *config.SIPSettings) *HEPProcessor {
+	p := &HEPProcessor{}
+	p.SetSettings(settings)
+	return p
+}
+
+// SetSettings replaces the settings used to extract the accounts from the SIP messages
+func (s *HEPProcessor) SetSettings(settings *config.SIPSettings) {
+	s.settings.Store(settings)
 }
 
-// Process raw bytes containing a HEP packet
-func (s *HEPProcessor) Process(packet []byte) (*model.SIPMessage, error) {
+// Process raw bytes containing a HEP packet, returning either the SIP message or, for
+// the RTCP packets, the quality report
+func (s *HEPProcessor) Process(packet []byte) (*model.SIPMessage, *model.QualityReport, error) {
 	hepPacket, err := s.hepFromBytes(packet)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if hepPacket.ProtoType == model.HEPProtoTypeRTCP {
+		report, err := model.QualityReportFromHEP(hepPacket)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, report, nil
+	}
+	return model.SIPMessageFromHEP(hepPacket, s.settings.Load().(*config.SIPSettings)), nil, nil
+}
+
+// ProcessSIP processes raw bytes containing a SIP message not encapsulated in HEP,
+// using the given timestamp and addresses in place of the ones carried by HEP
+func (s *HEPProcessor) ProcessSIP(packet []byte, timestamp time.Time, src, dst *net.UDPAddr) (*model.SIPMessage, error) {
+	hepPacket := hepFromSIP(packet, timestamp, src, dst)
+	msg := model.SIPMessageFromHEP(hepPacket, s.settings.Load().(*config.SIPSettings))
+	if msg.Error != nil {
+		return nil, errors.Wrap(msg.Error, "unable to parse the SIP message")
+	}
+	if msg.CallID == "" {
+		return nil, errors.New("unable to parse the SIP message: missing Call-ID")
+	}
+	if msg.Cseq == nil || msg.CseqMethod == "" {
+		return nil, errors.New("unable to parse the SIP message: missing CSeq")
+	}
+	return msg, nil
+}
+
+func hepFromSIP(packet []byte, timestamp time.Time, src, dst *net.UDPAddr) *decoder.HEP {
+	version := uint32(0x02)
+	if src.IP.To4() == nil {
+		version = 0x0a
+	}
+	return &decoder.HEP{
+		Version:   version,
+		Protocol:  0x11,
+		SrcIP:     src.IP.String(),
+		DstIP:     dst.IP.String(),
+		SrcPort:   uint32(src.Port),
+		DstPort:   uint32(dst.Port),
+		Tsec:      uint32(timestamp.Unix()),
+		Tmsec:     uint32(timestamp.Nanosecond() / 1000),
+		ProtoType: model.HEPProtoTypeSIP,
+		Payload:   string(packet),
+		Timestamp: timestamp,
 	}
-	return model.SIPMessageFromHEP(hepPacket), nil
 }
 
 func (s *HEPProcessor) hepFromBytes(packet []byte) (*decoder.HEP, error) {
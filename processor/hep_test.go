@@ -2,43 +2,71 @@ package processor
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/sipcapture/heplify-server/decoder"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/model"
 )
 
 func TestNewHEPProcessor(t *testing.T) {
-	srv := NewHEPProcessor()
+	srv := NewHEPProcessor(&config.SIPSettings{})
 	assert.NotNil(t, srv)
 }
 
 func TestProcess(t *testing.T) {
-	srv := NewHEPProcessor()
+	srv := NewHEPProcessor(&config.SIPSettings{})
 
 	cwd, _ := os.Getwd()
 	path := filepath.Join(cwd, "..", "testdata", "hep-invite.bin")
 	packet, _ := ioutil.ReadFile(path)
 
-	msg, err := srv.Process(packet)
+	msg, _, err := srv.Process(packet)
 	assert.Nil(t, err)
 	assert.NotNil(t, msg)
 	assert.Equal(t, "INVITE", string(msg.FirstMethod))
 }
 
+func TestProcessWithSettings(t *testing.T) {
+	srv := NewHEPProcessor(&config.SIPSettings{})
+
+	cwd, _ := os.Getwd()
+	path := filepath.Join(cwd, "..", "testdata", "hep-invite.bin")
+	packet, _ := ioutil.ReadFile(path)
+
+	msg, _, err := srv.Process(packet)
+	assert.Nil(t, err)
+	assert.Equal(t, "", msg.AccountTag)
+	assert.Equal(t, "", msg.DestinationAccountTag)
+
+	srv.SetSettings(&config.SIPSettings{
+		LocalDomains: []string{"192.168.192.2", "anotherdomain.com"},
+	})
+
+	msg, _, err = srv.Process(packet)
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", msg.AccountTag)
+	assert.Equal(t, "39040123456", msg.DestinationAccountTag)
+}
+
 func TestProcessInvalid(t *testing.T) {
-	srv := NewHEPProcessor()
+	srv := NewHEPProcessor(&config.SIPSettings{})
 
 	packet := []byte{}
 
-	msg, err := srv.Process(packet)
+	msg, _, err := srv.Process(packet)
 	assert.Error(t, err)
 	assert.Nil(t, msg)
 }
 
 func TestHepFromBytesInvalid(t *testing.T) {
-	srv := NewHEPProcessor()
+	srv := NewHEPProcessor(&config.SIPSettings{})
 
 	packet := []byte{}
 
@@ -49,7 +77,7 @@ func TestHepFromBytesInvalid(t *testing.T) {
 }
 
 func TestHepFromBytes(t *testing.T) {
-	srv := NewHEPProcessor()
+	srv := NewHEPProcessor(&config.SIPSettings{})
 
 	cwd, _ := os.Getwd()
 	path := filepath.Join(cwd, "..", "testdata", "hep-invite.bin")
@@ -85,3 +113,92 @@ func TestHepFromBytes(t *testing.T) {
 		"a=rtpmap:0 PCMU/8000\r\n"
 	assert.Equal(t, expectedPayload, hepPacket.Payload)
 }
+
+func TestProcessSIP(t *testing.T) {
+	srv := NewHEPProcessor(&config.SIPSettings{
+		LocalDomains: []string{"192.168.192.2", "anotherdomain.com"},
+	})
+
+	cwd, _ := os.Getwd()
+	path := filepath.Join(cwd, "..", "testdata", "hep-invite.bin")
+	packet, _ := ioutil.ReadFile(path)
+
+	hepPacket, err := srv.hepFromBytes(packet)
+	assert.Nil(t, err)
+
+	timestamp := time.Date(2020, 3, 14, 8, 56, 7, 0, time.UTC)
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+
+	msg, err := srv.ProcessSIP([]byte(hepPacket.Payload), timestamp, src, dst)
+	assert.Nil(t, err)
+	assert.NotNil(t, msg)
+	assert.Equal(t, "INVITE", msg.FirstMethod)
+	assert.Equal(t, "1-18@192.168.192.2", msg.CallID)
+	assert.Equal(t, "1000", msg.AccountTag)
+	assert.Equal(t, timestamp, msg.Timestamp)
+}
+
+func TestProcessSIPInvalid(t *testing.T) {
+	srv := NewHEPProcessor(&config.SIPSettings{})
+
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+
+	msg, err := srv.ProcessSIP([]byte("DUMMY"), time.Now(), src, dst)
+	assert.Error(t, err)
+	assert.Nil(t, msg)
+}
+
+func TestProcessSIPMissingCSeq(t *testing.T) {
+	srv := NewHEPProcessor(&config.SIPSettings{})
+
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+	payload := "INVITE sip:service@192.168.192.5:5060 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.168.192.2:5060;branch=z9hG4bK-18-1-0\r\n" +
+		"From: sipp <sip:1000@192.168.192.2:5060>;tag=1\r\n" +
+		"To: sut <sip:39040123456@anotherdomain.com:5060>\r\n" +
+		"Call-ID: 1-18@192.168.192.2\r\n" +
+		"Content-Length: 0\r\n\r\n"
+
+	msg, err := srv.ProcessSIP([]byte(payload), time.Now(), src, dst)
+	assert.EqualError(t, err, "unable to parse the SIP message: missing CSeq")
+	assert.Nil(t, msg)
+}
+
+func TestProcessRTCP(t *testing.T) {
+	srv := NewHEPProcessor(&config.SIPSettings{})
+
+	hep := &decoder.HEP{
+		Version:   2,
+		Protocol:  0x11,
+		SrcIP:     "192.168.192.2",
+		DstIP:     "192.168.192.5",
+		SrcPort:   6001,
+		DstPort:   7001,
+		Tsec:      1584176168,
+		ProtoType: model.HEPProtoTypeRTCP,
+		NodeID:    1,
+		Payload:   `{"ssrc":1,"report_blocks":[{"source_ssrc":2,"fraction_lost":0,"ia_jitter":80}]}`,
+		CID:       "1-18@192.168.192.2",
+	}
+	packet, err := hep.Marshal()
+	assert.Nil(t, err)
+
+	msg, report, err := srv.Process(packet)
+	assert.Nil(t, err)
+	assert.Nil(t, msg)
+	assert.Equal(t, "1-18@192.168.192.2", report.CallID)
+	assert.Equal(t, time.Unix(1584176168, 0), report.Timestamp)
+	assert.Len(t, report.Samples, 1)
+
+	hep.Payload = "DUMMY"
+	packet, err = hep.Marshal()
+	assert.Nil(t, err)
+
+	msg, report, err = srv.Process(packet)
+	assert.Error(t, err)
+	assert.Nil(t, msg)
+	assert.Nil(t, report)
+}
@@ -0,0 +1,210 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// RTCP packet types
+const (
+	TypeSenderReport   = 200
+	TypeReceiverReport = 201
+	TypeExtendedReport = 207
+)
+
+// BlockTypeVoIPMetrics is the type of the VoIP metrics blocks of the extended reports (RFC 3611)
+const BlockTypeVoIPMetrics = 7
+
+// Unavailable is the value of the R factor and MOS fields of the VoIP metrics when
+// they are not available
+const Unavailable = 127
+
+const (
+	headerLength      = 4
+	senderInfoLength  = 20
+	reportBlockLength = 24
+	voipMetricsLength = 32
+)
+
+// Report is the content of a compound RTCP packet
+type Report struct {
+	SSRC        uint32
+	Blocks      []ReportBlock
+	VoIPMetrics []VoIPMetrics
+}
+
+// ReportBlock is a reception report of a sender or receiver report
+type ReportBlock struct {
+	SSRC uint32
+	// FractionLost is the fraction of the packets lost since the previous report
+	FractionLost float64
+	// PacketsLost is the cumulative number of packets lost
+	PacketsLost int32
+	// Jitter is the interarrival jitter, in timestamp units
+	Jitter uint32
+}
+
+// VoIPMetrics is a VoIP metrics block of an extended report
+type VoIPMetrics struct {
+	SSRC           uint32
+	LossRate       float64
+	DiscardRate    float64
+	RoundTripDelay uint16
+	// RFactor is Unavailable if not available
+	RFactor uint8
+	// MOSLQ and MOSCQ are zero if not available
+	MOSLQ float64
+	MOSCQ float64
+}
+
+// jsonReport is the RTCP report encoded in JSON by heplify
+type jsonReport struct {
+	SSRC         uint32 `json:"ssrc"`
+	ReportBlocks []struct {
+		SourceSSRC   uint32 `json:"source_ssrc"`
+		FractionLost uint8  `json:"fraction_lost"`
+		PacketsLost  int32  `json:"packets_lost"`
+		Jitter       uint32 `json:"ia_jitter"`
+	} `json:"report_blocks"`
+}
+
+// Decode decodes a compound RTCP packet, or its JSON encoding by heplify
+func Decode(payload []byte) (*Report, error) {
+	if len(payload) > 0 && payload[0] == '{' {
+		return decodeJSON(payload)
+	}
+	return decodeBinary(payload)
+}
+
+func decodeJSON(payload []byte) (*Report, error) {
+	decoded := &jsonReport{}
+	if err := json.Unmarshal(payload, decoded); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the RTCP report")
+	}
+	report := &Report{SSRC: decoded.SSRC}
+	for _, block := range decoded.ReportBlocks {
+		report.Blocks = append(report.Blocks, ReportBlock{
+			SSRC:         block.SourceSSRC,
+			FractionLost: float64(block.FractionLost) / 256,
+			PacketsLost:  block.PacketsLost,
+			Jitter:       block.Jitter,
+		})
+	}
+	return report, nil
+}
+
+func decodeBinary(payload []byte) (*Report, error) {
+	if len(payload) < headerLength {
+		return nil, errors.New("unable to decode the RTCP report: packet too short")
+	}
+	report := &Report{}
+	for len(payload) > 0 {
+		if len(payload) < headerLength || payload[0]>>6 != 2 {
+			return nil, errors.New("unable to decode the RTCP report: invalid header")
+		}
+		length := (int(binary.BigEndian.Uint16(payload[2:4])) + 1) * 4
+		if length > len(payload) {
+			return nil, errors.New("unable to decode the RTCP report: truncated packet")
+		}
+		count := int(payload[0] & 0x1f)
+		packetType := payload[1]
+		body := payload[headerLength:length]
+		payload = payload[length:]
+
+		switch packetType {
+		case TypeSenderReport:
+			if len(body) < 4+senderInfoLength {
+				return nil, errors.New("unable to decode the RTCP report: truncated sender report")
+			}
+			report.SSRC = binary.BigEndian.Uint32(body)
+			blocks, err := decodeReportBlocks(body[4+senderInfoLength:], count)
+			if err != nil {
+				return nil, err
+			}
+			report.Blocks = append(report.Blocks, blocks...)
+		case TypeReceiverReport:
+			if len(body) < 4 {
+				return nil, errors.New("unable to decode the RTCP report: truncated receiver report")
+			}
+			report.SSRC = binary.BigEndian.Uint32(body)
+			blocks, err := decodeReportBlocks(body[4:], count)
+			if err != nil {
+				return nil, err
+			}
+			report.Blocks = append(report.Blocks, blocks...)
+		case TypeExtendedReport:
+			if len(body) < 4 {
+				return nil, errors.New("unable to decode the RTCP report: truncated extended report")
+			}
+			report.SSRC = binary.BigEndian.Uint32(body)
+			metrics, err := decodeExtendedBlocks(body[4:])
+			if err != nil {
+				return nil, err
+			}
+			report.VoIPMetrics = append(report.VoIPMetrics, metrics...)
+		}
+	}
+	return report, nil
+}
+
+func decodeReportBlocks(data []byte, count int) ([]ReportBlock, error) {
+	if len(data) < count*reportBlockLength {
+		return nil, errors.New("unable to decode the RTCP report: truncated report block")
+	}
+	blocks := make([]ReportBlock, 0, count)
+	for i := 0; i < count; i++ {
+		block := data[i*reportBlockLength : (i+1)*reportBlockLength]
+		// the cumulative number of packets lost is a signed 24 bits integer
+		lost := int32(binary.BigEndian.Uint32(block[4:8])<<8) >> 8
+		blocks = append(blocks, ReportBlock{
+			SSRC:         binary.BigEndian.Uint32(block),
+			FractionLost: float64(block[4]) / 256,
+			PacketsLost:  lost,
+			Jitter:       binary.BigEndian.Uint32(block[12:16]),
+		})
+	}
+	return blocks, nil
+}
+
+// decodeExtendedBlocks decodes the VoIP metrics blocks of an extended report,
+// skipping the other block types
+func decodeExtendedBlocks(data []byte) ([]VoIPMetrics, error) {
+	metrics := []VoIPMetrics{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("unable to decode the RTCP report: truncated extended report block")
+		}
+		length := (int(binary.BigEndian.Uint16(data[2:4])) + 1) * 4
+		if length > len(data) {
+			return nil, errors.New("unable to decode the RTCP report: truncated extended report block")
+		}
+		block := data[:length]
+		data = data[length:]
+		if block[0] != BlockTypeVoIPMetrics {
+			continue
+		}
+		if len(block) < 4+voipMetricsLength {
+			return nil, errors.New("unable to decode the RTCP report: truncated VoIP metrics block")
+		}
+		metrics = append(metrics, VoIPMetrics{
+			SSRC:           binary.BigEndian.Uint32(block[4:8]),
+			LossRate:       float64(block[8]) / 256,
+			DiscardRate:    float64(block[9]) / 256,
+			RoundTripDelay: binary.BigEndian.Uint16(block[16:18]),
+			RFactor:        block[24],
+			MOSLQ:          decodeMOS(block[26]),
+			MOSCQ:          decodeMOS(block[27]),
+		})
+	}
+	return metrics, nil
+}
+
+// decodeMOS returns the MOS of the VoIP metrics, encoded multiplied by 10
+func decodeMOS(value byte) float64 {
+	if value == Unavailable || value == 0 {
+		return 0
+	}
+	return float64(value) / 10
+}
@@ -0,0 +1,99 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSenderReport() []byte {
+	packet := make([]byte, 52)
+	packet[0] = 0x81
+	packet[1] = TypeSenderReport
+	binary.BigEndian.PutUint16(packet[2:], 12)
+	binary.BigEndian.PutUint32(packet[4:], 0x11111111)
+	block := packet[28:]
+	binary.BigEndian.PutUint32(block, 0x22222222)
+	binary.BigEndian.PutUint32(block[4:], 0x40fffffe)
+	binary.BigEndian.PutUint32(block[12:], 160)
+	return packet
+}
+
+func newExtendedReport(mos byte) []byte {
+	packet := make([]byte, 56)
+	packet[0] = 0x80
+	packet[1] = TypeExtendedReport
+	binary.BigEndian.PutUint16(packet[2:], 13)
+	binary.BigEndian.PutUint32(packet[4:], 0x11111111)
+	// a receiver reference time block, skipped
+	packet[8] = 4
+	binary.BigEndian.PutUint16(packet[10:], 2)
+	block := packet[20:]
+	block[0] = BlockTypeVoIPMetrics
+	binary.BigEndian.PutUint16(block[2:], 8)
+	binary.BigEndian.PutUint32(block[4:], 0x22222222)
+	block[8] = 32
+	binary.BigEndian.PutUint16(block[16:], 120)
+	block[24] = 80
+	block[26] = mos
+	block[27] = Unavailable
+	return packet
+}
+
+func TestDecode(t *testing.T) {
+	report, err := Decode(append(newSenderReport(), newExtendedReport(41)...))
+	assert.Nil(t, err)
+	assert.Equal(t, &Report{
+		SSRC: 0x11111111,
+		Blocks: []ReportBlock{
+			{SSRC: 0x22222222, FractionLost: 0.25, PacketsLost: -2, Jitter: 160},
+		},
+		VoIPMetrics: []VoIPMetrics{
+			{SSRC: 0x22222222, LossRate: 0.125, RoundTripDelay: 120, RFactor: 80, MOSLQ: 4.1},
+		},
+	}, report)
+
+	report, err = Decode(newExtendedReport(Unavailable))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), report.VoIPMetrics[0].MOSLQ)
+
+	// receiver reports without report blocks
+	report, err = Decode([]byte{0x80, TypeReceiverReport, 0, 1, 0x11, 0x11, 0x11, 0x11})
+	assert.Nil(t, err)
+	assert.Equal(t, &Report{SSRC: 0x11111111}, report)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	report, err := Decode([]byte(`{"type":200,"ssrc":286331153,"report_count":1,` +
+		`"report_blocks":[{"source_ssrc":572662306,"fraction_lost":64,"packets_lost":5,` +
+		`"highest_seq_no":1000,"ia_jitter":160,"lsr":0,"dlsr":0}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, &Report{
+		SSRC: 0x11111111,
+		Blocks: []ReportBlock{
+			{SSRC: 0x22222222, FractionLost: 0.25, PacketsLost: 5, Jitter: 160},
+		},
+	}, report)
+
+	_, err = Decode([]byte(`{"ssrc":`))
+	assert.Error(t, err)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	var tests = []struct {
+		payload []byte
+		err     string
+	}{
+		{[]byte{0x80}, "unable to decode the RTCP report: packet too short"},
+		{[]byte{0x00, TypeReceiverReport, 0, 1, 0, 0, 0, 0}, "unable to decode the RTCP report: invalid header"},
+		{newSenderReport()[:40], "unable to decode the RTCP report: truncated packet"},
+		{[]byte{0x81, TypeReceiverReport, 0, 1, 0, 0, 0, 0}, "unable to decode the RTCP report: truncated report block"},
+		{[]byte{0x80, TypeExtendedReport, 0, 2, 0, 0, 0, 0, BlockTypeVoIPMetrics, 0, 0, 0},
+			"unable to decode the RTCP report: truncated VoIP metrics block"},
+	}
+	for _, test := range tests {
+		_, err := Decode(test.payload)
+		assert.EqualError(t, err, test.err)
+	}
+}
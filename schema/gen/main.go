@@ -0,0 +1,30 @@
+// Command gen writes the JSON Schema documents of the events to a directory
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/canyanio/rating-agent-hep/schema"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: gen <output directory>")
+		os.Exit(2)
+	}
+	for _, routingKey := range schema.RoutingKeys() {
+		data, err := schema.Generate(routingKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		path := filepath.Join(os.Args[1], schema.FileName(routingKey))
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
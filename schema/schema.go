@@ -0,0 +1,105 @@
+package schema
+
+//go:generate go run ./gen ../docs/schemas
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/jsonschema"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// FileExtension is the extension of the JSON Schema files
+const FileExtension = ".schema.json"
+
+// events are the messages published to the message bus, per routing key
+var events = map[string]struct {
+	event       model.Event
+	version     string
+	title       string
+	description string
+}{
+	rabbitmq.QueueNameBeginTransaction: {
+		event:       &model.BeginTransaction{},
+		version:     model.TransactionSchemaVersion,
+		title:       "Begin transaction",
+		description: "Published when a call is answered, to begin the rating of the transaction.",
+	},
+	rabbitmq.QueueNameEndTransaction: {
+		event:       &model.EndTransaction{},
+		version:     model.TransactionSchemaVersion,
+		title:       "End transaction",
+		description: "Published when a call ends, to end the rating of the transaction.",
+	},
+	rabbitmq.QueueNameCallDetailRecord: {
+		event:       &model.CallDetailRecord{},
+		version:     model.CallDetailRecordSchemaVersion,
+		title:       "Call detail record",
+		description: "Consolidated record of a call, published when the call ends.",
+	},
+}
+
+// RoutingKeys returns the routing keys of the events, sorted
+func RoutingKeys() []string {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FileName returns the name of the JSON Schema file of the events with a routing key
+func FileName(routingKey string) string {
+	return routingKey + FileExtension
+}
+
+// Generate returns the JSON Schema document of the events with a routing key,
+// reflected from the model type
+func Generate(routingKey string) ([]byte, error) {
+	e, ok := events[routingKey]
+	if !ok {
+		return nil, errors.Errorf("unknown routing key: %s", routingKey)
+	}
+	// fields are added within the same major version, without breaking the consumers
+	// validating the messages with a previous schema
+	reflector := &jsonschema.Reflector{
+		ExpandedStruct:            true,
+		AllowAdditionalProperties: true,
+	}
+	s := reflector.Reflect(e.event)
+	s.Title = e.title
+	s.Description = e.description + " Schema version " + e.version + "."
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal the schema")
+	}
+	return append(data, '\n'), nil
+}
+
+// Validate validates a message against the JSON Schema of its routing key
+func Validate(routingKey string, message []byte) error {
+	document, err := Generate(routingKey)
+	if err != nil {
+		return err
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(document),
+		gojsonschema.NewBytesLoader(message))
+	if err != nil {
+		return errors.Wrap(err, "unable to validate the message")
+	}
+	if !result.Valid() {
+		errs := []string{}
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return errors.Errorf("invalid %s message: %s", routingKey, strings.Join(errs, "; "))
+	}
+	return nil
+}
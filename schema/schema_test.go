@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+func TestSchemaFilesUpToDate(t *testing.T) {
+	for _, routingKey := range RoutingKeys() {
+		expected, err := Generate(routingKey)
+		assert.Nil(t, err)
+
+		data, err := ioutil.ReadFile(filepath.Join("..", "docs", "schemas", FileName(routingKey)))
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(data), "run go generate ./schema to update %s",
+			FileName(routingKey))
+	}
+}
+
+func TestGenerateUnknownRoutingKey(t *testing.T) {
+	_, err := Generate("unknown")
+	assert.EqualError(t, err, "unknown routing key: unknown")
+}
+
+func TestValidate(t *testing.T) {
+	begin, _ := json.Marshal(&model.BeginTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.BeginTransactionRequest{
+			Tenant:         "default",
+			TransactionTag: "call-1",
+			AccountTag:     "1000",
+			TimestampBegin: "2020-03-14T08:56:08Z",
+		},
+	})
+	err := Validate(rabbitmq.QueueNameBeginTransaction, begin)
+	assert.Nil(t, err)
+
+	// the minor versions are compatible with the schema
+	err = Validate(rabbitmq.QueueNameEndTransaction, []byte(`{"schema_version":"1.1","request":{`+
+		`"tenant":"default","transaction_tag":"call-1","account_tag":"1000","destination_account_tag":"",`+
+		`"timestamp_end":"2020-03-14T08:56:08Z","new_field":true}}`))
+	assert.Nil(t, err)
+
+	err = Validate(rabbitmq.QueueNameEndTransaction, []byte(`{"schema_version":"2.0","request":{`+
+		`"tenant":"default","transaction_tag":"call-1","account_tag":"1000","destination_account_tag":"",`+
+		`"timestamp_end":"yesterday"}}`))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid end_transaction message")
+		assert.Contains(t, err.Error(), "schema_version")
+		assert.Contains(t, err.Error(), "timestamp_end")
+	}
+
+	err = Validate(rabbitmq.QueueNameCallDetailRecord, []byte(`{"schema_version":"1.0"}`))
+	assert.NotNil(t, err)
+
+	err = Validate(rabbitmq.QueueNameCallDetailRecord, []byte(`not JSON`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/sirupsen/logrus"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+// Admin API specific constants
+const (
+	AdminPathCalls        = "/admin/calls"
+	CallStateRinging      = "ringing"
+	CallStateAnswered     = "answered"
+	CallStateClosed       = "closed"
+	CallStateDiscarded    = "discarded"
+	AdminFilterAccountTag = "account_tag"
+	AdminFilterTenant     = "tenant"
+	AdminActionClose      = "close"
+	AdminActionDiscard    = "discard"
+)
+
+// CallStatus is a call tracked by the state manager, as returned by the admin API
+type CallStatus struct {
+	*model.Call
+	State string `json:"state"`
+}
+
+// CallList is the list of calls returned by the admin API
+type CallList struct {
+	Calls []*CallStatus `json:"calls"`
+}
+
+// AdminError is the body of the admin API error responses
+type AdminError struct {
+	Error string `json:"error"`
+}
+
+func newCallStatus(call *model.Call) *CallStatus {
+	state := CallStateRinging
+	if !call.TimestampAck.IsZero() {
+		state = CallStateAnswered
+	}
+	return &CallStatus{
+		Call:  call,
+		State: state,
+	}
+}
+
+// adminCalls lists the calls tracked by the state manager, optionally filtered by
+// account tag (either the source or the destination one) and tenant
+func (s *Server) adminCalls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	accountTag := query.Get(AdminFilterAccountTag)
+	tenant := query.Get(AdminFilterTenant)
+
+	calls := []*CallStatus{}
+	err := s.state.Scan(r.Context(), func(key string, data []byte) error {
+		call := &model.Call{}
+		if err := json.Unmarshal(data, call); err != nil || call.CSeq == "" {
+			// not a call
+			return nil
+		}
+		if accountTag != "" && call.AccountTag != accountTag && call.DestinationAccountTag != accountTag {
+			return nil
+		}
+		if tenant != "" && call.Tenant != tenant {
+			return nil
+		}
+		calls = append(calls, newCallStatus(call))
+		return nil
+	})
+	if err != nil {
+		log.FromContext(r.Context()).Error(err)
+		writeAdminError(w, http.StatusInternalServerError, "unable to list the calls")
+		return
+	}
+
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].TimestampInvite.Before(calls[j].TimestampInvite)
+	})
+	writeAdminResponse(w, http.StatusOK, &CallList{Calls: calls})
+}
+
+// adminAuth requires the admin token as bearer token; the admin API is disabled if
+// the admin token is not set, as the calls carry the account tags
+func (s *Server) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.getSettings().AdminToken
+		if token == "" {
+			writeAdminError(w, http.StatusForbidden, "the admin API is disabled, admin_token is not set")
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminCall returns a single call tracked by the state manager, or runs an action on it;
+// the action is the last segment of the path, the Call-IDs can contain slashes
+func (s *Server) adminCall(w http.ResponseWriter, r *http.Request) {
+	callID := strings.TrimPrefix(r.URL.Path, AdminPathCalls+"/")
+	if callID == "" {
+		s.adminCalls(w, r)
+		return
+	}
+	for _, action := range []string{AdminActionClose, AdminActionDiscard} {
+		if strings.HasSuffix(callID, "/"+action) && len(callID) > len(action)+1 {
+			s.adminCallAction(w, r, strings.TrimSuffix(callID, "/"+action), action)
+			return
+		}
+	}
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	call := &model.Call{}
+	if err := s.state.Get(r.Context(), callID, call); err != nil {
+		log.FromContext(r.Context()).Error(err)
+		writeAdminError(w, http.StatusInternalServerError, "unable to retrieve the call")
+		return
+	} else if call.CSeq == "" {
+		writeAdminError(w, http.StatusNotFound, "call not found")
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, newCallStatus(call))
+}
+
+// adminCallAction force-closes or discards a call tracked by the state manager
+func (s *Server) adminCallAction(w http.ResponseWriter, r *http.Request, callID, action string) {
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	req := &model.CloseCallRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+		writeAdminError(w, http.StatusBadRequest, "unable to decode the request")
+		return
+	}
+
+	timestampEnd := time.Now()
+	if req.TimestampEnd != "" {
+		var err error
+		timestampEnd, err = time.Parse(time.RFC3339, req.TimestampEnd)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, "timestamp_end is not a valid RFC 3339 timestamp")
+			return
+		}
+	}
+
+	call := &model.Call{}
+	if err := s.state.Get(ctx, callID, call); err != nil {
+		l.Error(err)
+		writeAdminError(w, http.StatusInternalServerError, "unable to retrieve the call")
+		return
+	} else if call.CSeq == "" {
+		writeAdminError(w, http.StatusNotFound, "call not found")
+		return
+	}
+
+	if action == AdminActionClose && timestampEnd.Before(call.TimestampInvite) {
+		writeAdminError(w, http.StatusBadRequest, "timestamp_end precedes the beginning of the call")
+		return
+	}
+
+	// claim the end of the call, as a BYE or CANCEL received meanwhile does
+	if !s.transition(ctx, callID, action, map[string]interface{}{
+		model.CallFieldTimestampBye: time.Time{},
+	}, map[string]interface{}{
+		model.CallFieldTimestampBye: timestampEnd,
+	}, StateManagerTTLCall) {
+		current := &model.Call{}
+		if err := s.state.Get(ctx, callID, current); err != nil {
+			l.Error(err)
+			writeAdminError(w, http.StatusInternalServerError, "unable to retrieve the call")
+		} else if current.CSeq == "" {
+			writeAdminError(w, http.StatusNotFound, "call not found")
+		} else {
+			writeAdminError(w, http.StatusConflict, "the call is already ending")
+		}
+		return
+	}
+
+	fields := logrus.Fields{
+		"audit":                   true,
+		"action":                  action,
+		"call-id":                 callID,
+		"tenant":                  call.Tenant,
+		"account-tag":             call.AccountTag,
+		"destination-account-tag": call.DestinationAccountTag,
+		"remote":                  r.RemoteAddr,
+		"reason":                  req.Reason,
+	}
+
+	// the calls not answered have no transaction to end, they are recorded as cancelled
+	answered := !call.TimestampAck.IsZero()
+	if action == AdminActionClose && !answered {
+		call.TimestampBye = timestampEnd
+		fields["timestamp-end"] = timestampEnd.UTC().Format(time.RFC3339)
+		if call.FinalCode == 0 {
+			call.FinalCode = 487
+		}
+	} else if action == AdminActionClose {
+		call.TimestampBye = timestampEnd
+		fields["timestamp-end"] = timestampEnd.UTC().Format(time.RFC3339)
+
+		err := s.publish(ctx, rabbitmq.QueueNameEndTransaction, newEndTransaction(call.Tenant, call, timestampEnd))
+		if err != nil {
+			// release the call, so that the action can be retried
+			call.TimestampBye = time.Time{}
+			s.state.UpdateIf(ctx, callID, map[string]interface{}{
+				model.CallFieldTimestampBye: timestampEnd,
+			}, map[string]interface{}{
+				model.CallFieldTimestampBye: time.Time{},
+			}, StateManagerTTLCall)
+
+			fields["err"] = err.Error()
+			l.WithFields(fields).Error("admin action failed: unable to publish the request")
+			writeAdminError(w, http.StatusBadGateway, "unable to publish the request")
+			return
+		}
+		observeCallDuration(call, timestampEnd)
+	}
+
+	if err := s.state.Delete(ctx, callID); err != nil {
+		l.WithFields(fields).WithField("err", err.Error()).Error("unable to delete the call")
+	}
+
+	if settings := s.getSettings(); action == AdminActionClose && settings.PublishCDRs {
+		cdr := newCallDetailRecord(settings, call, timestampEnd)
+		if err := s.publish(ctx, rabbitmq.QueueNameCallDetailRecord, cdr); err != nil {
+			l.WithFields(fields).WithField("err", err.Error()).Error("unable to publish the call detail record")
+		}
+	}
+
+	l.WithFields(fields).Info("admin action")
+
+	status := newCallStatus(call)
+	status.State = CallStateDiscarded
+	if action == AdminActionClose {
+		status.State = CallStateClosed
+	}
+	writeAdminResponse(w, http.StatusOK, status)
+}
+
+func writeAdminResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	writeAdminResponse(w, status, &AdminError{Error: message})
+}
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	mock_rabbitmq "github.com/canyanio/rating-agent-hep/client/rabbitmq/mock"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+func newAdminRequest(method, path, token, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func newAdminTestServer(t *testing.T, adminToken string) *Server {
+	settings := newTestSettings()
+	settings.AdminToken = adminToken
+
+	srv := NewServer(settings)
+	assert.NotNil(t, srv)
+
+	ctx := context.Background()
+	now := time.Date(2020, 3, 14, 8, 56, 0, 0, time.UTC)
+	calls := []*model.Call{
+		{
+			Tenant:          "default",
+			TransactionTag:  "call-1",
+			AccountTag:      "1000",
+			CSeq:            "1",
+			TimestampInvite: now,
+			TimestampAck:    now.Add(time.Second),
+		},
+		{
+			Tenant:                "default",
+			TransactionTag:        "call-2",
+			DestinationAccountTag: "2000",
+			CSeq:                  "1",
+			TimestampInvite:       now.Add(-time.Minute),
+		},
+		{
+			Tenant:          "other",
+			TransactionTag:  "call-3",
+			AccountTag:      "1000",
+			CSeq:            "1",
+			TimestampInvite: now.Add(time.Minute),
+		},
+	}
+	for _, call := range calls {
+		srv.state.Set(ctx, call.TransactionTag, call, StateManagerTTLCall)
+	}
+	return srv
+}
+
+func TestAdminCalls(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	testCases := map[string]struct {
+		query    string
+		expected []string
+	}{
+		"all": {
+			expected: []string{"call-2", "call-1", "call-3"},
+		},
+		"account tag": {
+			query:    "?account_tag=1000",
+			expected: []string{"call-1", "call-3"},
+		},
+		"destination account tag": {
+			query:    "?account_tag=2000",
+			expected: []string{"call-2"},
+		},
+		"tenant": {
+			query:    "?tenant=default",
+			expected: []string{"call-2", "call-1"},
+		},
+		"account tag and tenant": {
+			query:    "?tenant=other&account_tag=1000",
+			expected: []string{"call-3"},
+		},
+		"no match": {
+			query:    "?account_tag=3000",
+			expected: []string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+tc.query, "secret", ""))
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			list := &CallList{}
+			err := json.Unmarshal(w.Body.Bytes(), list)
+			assert.Nil(t, err)
+
+			callIDs := []string{}
+			for _, call := range list.Calls {
+				callIDs = append(callIDs, call.TransactionTag)
+			}
+			assert.Equal(t, tc.expected, callIDs)
+		})
+	}
+}
+
+func TestAdminCall(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call-1", "secret", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	call := &CallStatus{}
+	err := json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", call.TransactionTag)
+	assert.Equal(t, "1000", call.AccountTag)
+	assert.Equal(t, CallStateAnswered, call.State)
+	assert.Equal(t, "2020-03-14T08:56:01Z", call.TimestampAck.Format(time.RFC3339))
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call-2", "secret", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	call = &CallStatus{}
+	err = json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, CallStateRinging, call.State)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/unknown", "secret", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1", "secret", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	// the Call-IDs can contain slashes
+	call1 := &model.Call{}
+	srv.state.Get(context.Background(), "call-1", call1)
+	call1.TransactionTag = "call/1"
+	srv.state.Set(context.Background(), "call/1", call1, StateManagerTTLCall)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call%2F1", "secret", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	call = &CallStatus{}
+	err = json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, "call/1", call.TransactionTag)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call%2F1/discard", "secret", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminAuth(t *testing.T) {
+	testCases := map[string]struct {
+		adminToken string
+		token      string
+		method     string
+		path       string
+		status     int
+	}{
+		"read without admin token": {
+			method: http.MethodGet,
+			path:   AdminPathCalls,
+			status: http.StatusForbidden,
+		},
+		"action without admin token": {
+			method: http.MethodPost,
+			path:   AdminPathCalls + "/call-1/discard",
+			status: http.StatusForbidden,
+		},
+		"read without token": {
+			adminToken: "secret",
+			method:     http.MethodGet,
+			path:       AdminPathCalls + "/call-1",
+			status:     http.StatusUnauthorized,
+		},
+		"action with wrong token": {
+			adminToken: "secret",
+			token:      "wrong",
+			method:     http.MethodPost,
+			path:       AdminPathCalls + "/call-1/discard",
+			status:     http.StatusUnauthorized,
+		},
+		"read with token": {
+			adminToken: "secret",
+			token:      "secret",
+			method:     http.MethodGet,
+			path:       AdminPathCalls + "/call-1",
+			status:     http.StatusOK,
+		},
+		"action with token": {
+			adminToken: "secret",
+			token:      "secret",
+			method:     http.MethodPost,
+			path:       AdminPathCalls + "/call-1/discard",
+			status:     http.StatusOK,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := newAdminTestServer(t, tc.adminToken)
+
+			w := httptest.NewRecorder()
+			srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(tc.method, tc.path, tc.token, ""))
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+func TestAdminCallClose(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+		rabbitmq.QueueNameEndTransaction,
+		mock.MatchedBy(func(req *model.EndTransaction) bool {
+			assert.Equal(t, "default", req.Request.Tenant)
+			assert.Equal(t, "call-1", req.Request.TransactionTag)
+			assert.Equal(t, "1000", req.Request.AccountTag)
+			assert.Equal(t, "2020-03-14T09:00:00Z", req.Request.TimestampEnd)
+
+			return true
+		}),
+	).Return(nil)
+	srv.SetClient(mockClient)
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1/close", "secret",
+		`{"timestamp_end": "2020-03-14T10:00:00+01:00", "reason": "lost BYE"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	call := &CallStatus{}
+	err := json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, CallStateClosed, call.State)
+	assert.Equal(t, "2020-03-14T09:00:00Z", call.TimestampBye.UTC().Format(time.RFC3339))
+
+	// the call is not tracked anymore
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1/close", "secret", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestAdminCallCloseNotAnswered(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+	settings := *srv.getSettings()
+	settings.PublishCDRs = true
+	srv.settings.Store(&settings)
+
+	// no end transaction, the begin transaction was not published
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.MatchedBy(func(cdr *model.CallDetailRecord) bool {
+			return cdr.TransactionTag == "call-2" && cdr.Disposition == model.DispositionCancelled &&
+				cdr.SIPFinalCode == 487 && cdr.TimestampAnswer == "" && cdr.Duration == 0
+		})).Return(nil).Once()
+	srv.SetClient(mockClient)
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-2/close", "secret",
+		`{"timestamp_end": "2020-03-14T09:00:00Z"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	call := &CallStatus{}
+	err := json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, CallStateClosed, call.State)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call-2", "secret", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestAdminCallCloseInvalid(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	testCases := map[string]struct {
+		path string
+		body string
+	}{
+		"invalid body": {
+			path: AdminPathCalls + "/call-1/close",
+			body: "{",
+		},
+		"invalid timestamp": {
+			path: AdminPathCalls + "/call-1/close",
+			body: `{"timestamp_end": "yesterday"}`,
+		},
+		"timestamp before the invite": {
+			path: AdminPathCalls + "/call-1/close",
+			body: `{"timestamp_end": "2020-03-14T08:00:00Z"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, tc.path, "secret", tc.body))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1/unknown", "secret", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call-1/close", "secret", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestAdminCallClosePublishFailure(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+		rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction"),
+	).Return(errors.New("unable to publish"))
+	srv.SetClient(mockClient)
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1/close", "secret", ""))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	// the call is still tracked
+	call := &model.Call{}
+	err := srv.state.Get(context.Background(), "call-1", call)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-1", call.TransactionTag)
+	assert.True(t, call.TimestampBye.IsZero())
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestAdminCallCloseConflict(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	mockClient := &mock_rabbitmq.Client{}
+	srv.SetClient(mockClient)
+
+	// a BYE received meanwhile already ended the call
+	ctx := context.Background()
+	srv.state.Update(ctx, "call-1", map[string]interface{}{
+		model.CallFieldTimestampBye: time.Date(2020, 3, 14, 8, 58, 0, 0, time.UTC),
+	}, StateManagerTTLCall)
+
+	for _, action := range []string{AdminActionClose, AdminActionDiscard} {
+		w := httptest.NewRecorder()
+		srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-1/"+action, "secret", ""))
+		assert.Equal(t, http.StatusConflict, w.Code)
+	}
+
+	// nothing is published
+	mockClient.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAdminCallDiscard(t *testing.T) {
+	srv := newAdminTestServer(t, "secret")
+
+	mockClient := &mock_rabbitmq.Client{}
+	srv.SetClient(mockClient)
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodPost, AdminPathCalls+"/call-2/discard", "secret",
+		`{"reason": "test call"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	call := &CallStatus{}
+	err := json.Unmarshal(w.Body.Bytes(), call)
+	assert.Nil(t, err)
+	assert.Equal(t, "call-2", call.TransactionTag)
+	assert.Equal(t, CallStateDiscarded, call.State)
+
+	// the call is not tracked anymore
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, newAdminRequest(http.MethodGet, AdminPathCalls+"/call-2", "secret", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// nothing is published
+	mockClient.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"github.com/canyanio/rating-agent-hep/client/fanout"
+	"github.com/canyanio/rating-agent-hep/client/file"
+	"github.com/canyanio/rating-agent-hep/client/jetstream"
+	"github.com/canyanio/rating-agent-hep/client/kafka"
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	"github.com/canyanio/rating-agent-hep/client/webhook"
+	"github.com/canyanio/rating-agent-hep/codec"
+	dconfig "github.com/canyanio/rating-agent-hep/config"
+)
+
+// newClient returns the client publishing the requests to the configured message bus;
+// when additional sinks are set, or the file sink is enabled alongside another message
+// bus, the requests are published to all of them by a fan-out client
+func newClient(settings *dconfig.Settings) rabbitmq.ClientInterface {
+	client := newBusClient(settings, settings.MessageBusType)
+
+	names := settings.Sinks.Names
+	if settings.FileSink.Path != "" && settings.MessageBusType != dconfig.MessageBusTypeFile &&
+		!contains(names, dconfig.MessageBusTypeFile) {
+		names = append(append([]string{}, names...), dconfig.MessageBusTypeFile)
+	}
+	if len(names) == 0 {
+		return client
+	}
+
+	sinks := []fanout.Sink{{
+		Name:      settings.MessageBusType,
+		Client:    client,
+		Mandatory: true,
+	}}
+	for _, name := range names {
+		sinks = append(sinks, fanout.Sink{
+			Name:      name,
+			Client:    newBusClient(settings, name),
+			Mandatory: contains(settings.Sinks.Mandatory, name),
+		})
+	}
+	return fanout.NewClient(sinks, fanout.Options{
+		QueueSize:    settings.Sinks.QueueSize,
+		MaxRetries:   settings.Sinks.MaxRetries,
+		RetryBackoff: settings.Sinks.RetryBackoff,
+	})
+}
+
+// newBusClient returns the client publishing the requests to a message bus type
+func newBusClient(settings *dconfig.Settings, busType string) rabbitmq.ClientInterface {
+	messageCodec := codec.JSON
+	if settings.MessageEncoding == dconfig.MessageEncodingProtobuf {
+		messageCodec = codec.Protobuf
+	}
+
+	switch busType {
+	case dconfig.MessageBusTypeKafka:
+		client := kafka.NewClient(settings.Kafka.Brokers, map[string]string{
+			rabbitmq.QueueNameBeginTransaction: settings.Kafka.TopicBeginTransaction,
+			rabbitmq.QueueNameEndTransaction:   settings.Kafka.TopicEndTransaction,
+			rabbitmq.QueueNameCallDetailRecord: settings.Kafka.TopicCallDetailRecord,
+		})
+		client.SetCodec(messageCodec)
+		return client
+	case dconfig.MessageBusTypeNATS:
+		client := jetstream.NewClient(settings.NATS.URL, settings.NATS.Stream, settings.NATS.SubjectPrefix)
+		client.SetCodec(messageCodec)
+		return client
+	case dconfig.MessageBusTypeWebhook:
+		return webhook.NewClient(webhook.Options{
+			URLs: map[string]string{
+				rabbitmq.QueueNameBeginTransaction: settings.Webhook.URLBeginTransaction,
+				rabbitmq.QueueNameEndTransaction:   settings.Webhook.URLEndTransaction,
+				rabbitmq.QueueNameCallDetailRecord: settings.Webhook.URLCallDetailRecord,
+			},
+			Secret:         settings.Webhook.Secret,
+			Timeout:        settings.Webhook.Timeout,
+			MaxRetries:     settings.Webhook.MaxRetries,
+			RetryBackoff:   settings.Webhook.RetryBackoff,
+			Concurrency:    settings.Webhook.Concurrency,
+			DeadLetterFile: settings.Webhook.DeadLetterFile,
+			Codec:          messageCodec,
+		})
+	case dconfig.MessageBusTypeFile:
+		return file.NewClient(file.Options{
+			Path:     settings.FileSink.Path,
+			Format:   settings.FileSink.Format,
+			MaxSize:  settings.FileSink.MaxSize,
+			MaxAge:   settings.FileSink.MaxAge,
+			Compress: settings.FileSink.Compress,
+		})
+	default:
+		client := rabbitmq.NewClient(settings.MessageBusURI)
+		client.SetCodec(messageCodec)
+		client.SetPublishCDRs(settings.PublishCDRs)
+		return client
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,17 +3,19 @@ package server
 import (
 	"context"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	uuid "github.com/google/uuid"
-	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
 	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/dedup"
+	"github.com/canyanio/rating-agent-hep/metrics"
 	"github.com/canyanio/rating-agent-hep/model"
 )
 
@@ -25,21 +27,77 @@ const (
 	MethodCancel          = "CANCEL"
 	StateManagerTTLInvite = 600
 	StateManagerTTLCall   = 3600 * 6
+	QualityUpdateAttempts = 5
 )
 
-func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
+func (s *Server) handle(ctx context.Context, pkt packet) {
 	reqID := uuid.New()
 
 	l := log.FromContext(ctx)
 
-	msg, err := s.processor.Process(packet)
-	if err != nil {
-		l.Error(errors.Wrap(err, "unable to decode the HEP package"))
+	start := time.Now()
+	defer func() {
+		metrics.HandleDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	metrics.PacketsReceived.WithLabelValues(pkt.listener).Inc()
+
+	var msg *model.SIPMessage
+	var report *model.QualityReport
+	var err error
+	if pkt.listener == metrics.ListenerSIPUDP {
+		// raw SIP datagrams carry neither the capture timestamp nor the original
+		// addressing, they are replaced by the ones of the received datagram
+		src, _ := pkt.addr.(*net.UDPAddr)
+		dst, _ := pkt.localAddr.(*net.UDPAddr)
+		if src == nil || dst == nil {
+			err = errors.New("unsupported address type")
+		} else {
+			msg, err = s.processor.ProcessSIP(pkt.payload, time.Now(), src, dst)
+		}
+		if err != nil {
+			l.Error(errors.Wrap(err, "unable to decode the SIP message"))
+			l.WithFields(logrus.Fields{
+				"req-id": reqID,
+				"source": pkt.addr.String(),
+				"length": len(pkt.payload),
+			}).Error("unable to decode the SIP message")
+			metrics.DecodeFailures.WithLabelValues(pkt.listener).Inc()
+			return
+		}
+	} else {
+		msg, report, err = s.processor.Process(pkt.payload)
+		if err != nil {
+			l.Error(errors.Wrap(err, "unable to decode the HEP package"))
+			l.WithFields(logrus.Fields{
+				"req-id": reqID,
+				"source": pkt.addr.String(),
+				"length": len(pkt.payload),
+			}).Error("unable to decode the HEP package")
+			metrics.DecodeFailures.WithLabelValues(pkt.listener).Inc()
+			return
+		}
+	}
+
+	if report != nil {
+		s.handleQualityReport(ctx, reqID, pkt.addr, len(pkt.payload), report)
+		return
+	}
+	s.handleMessage(ctx, reqID, pkt.addr, len(pkt.payload), msg)
+}
+
+// handleMessage tracks the call status from the decoded SIP message and publishes
+// the begin and end transaction requests
+func (s *Server) handleMessage(ctx context.Context, reqID uuid.UUID, addr net.Addr, length int, msg *model.SIPMessage) {
+	l := log.FromContext(ctx)
+
+	// the HEP payloads are not validated by the processor
+	if msg.Cseq == nil || msg.CallID == "" {
 		l.WithFields(logrus.Fields{
 			"req-id": reqID,
 			"source": addr.String(),
-			"length": len(packet),
-		}).Error("unable to decode the HEP package")
+			"length": length,
+		}).Error("invalid SIP message, missing Call-ID or CSeq")
 		return
 	}
 
@@ -48,13 +106,55 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 	CSeqParts := strings.SplitN(msg.Cseq.Val, " ", 2)
 	CSeqID := CSeqParts[0]
 
-	productTag := config.Config.GetString(dconfig.SettingProductTag)
-	transactionTags := config.Config.GetStringSlice(dconfig.SettingTransactionTags)
+	settings := s.getSettings()
+
+	if agent := settings.SIP.CaptureAgent(msg.CaptureAgentID); agent != nil && !agent.Billing {
+		l.WithFields(logrus.Fields{
+			"req-id":        reqID,
+			"source":        addr.String(),
+			"length":        length,
+			"capture-agent": msg.CaptureAgentID,
+			"call-id":       callID,
+		}).Debug("message not trusted for billing, skipping it")
+		return
+	}
+
+	// the billing direction selects the INVITEs which start the calls, the other
+	// messages follow the call regardless of their direction
+	direction := settings.SIP.BillingDirectionFor(msg.CaptureAgentID)
+	if requestMethod == MethodInvite && direction != "" && direction != msg.Direction {
+		l.WithFields(logrus.Fields{
+			"req-id":        reqID,
+			"source":        addr.String(),
+			"length":        length,
+			"capture-agent": msg.CaptureAgentID,
+			"direction":     msg.Direction,
+			"call-id":       callID,
+		}).Debug("INVITE not in the billing direction, skipping it")
+		return
+	}
+
+	if s.dedup != nil && s.isDuplicate(ctx, settings, msg) {
+		l.WithFields(logrus.Fields{
+			"req-id":        reqID,
+			"source":        addr.String(),
+			"length":        length,
+			"capture-agent": msg.CaptureAgentID,
+			"call-id":       callID,
+		}).Debug("duplicate message, skipping it")
+		return
+	}
+
+	if requestMethod == "" {
+		metrics.SIPMessages.WithLabelValues(metrics.MethodResponse).Inc()
+	} else {
+		metrics.SIPMessages.WithLabelValues(requestMethod).Inc()
+	}
 
 	l.WithFields(logrus.Fields{
 		"req-id":        reqID,
 		"source":        addr.String(),
-		"length":        len(packet),
+		"length":        length,
 		"requestMethod": requestMethod,
 		"callID":        callID,
 		"CSeqID":        CSeqID,
@@ -62,14 +162,22 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 
 	var routingKey string
 	var req interface{}
+	var cdr *model.CallDetailRecord
 	if requestMethod == MethodInvite && (msg.AccountTag != "" || msg.DestinationAccountTag != "") {
 		call := &model.Call{
-			Tenant:                config.Config.GetString(dconfig.SettingTenant),
+			Tenant:                settings.Tenant,
 			TransactionTag:        callID,
 			AccountTag:            msg.AccountTag,
 			DestinationAccountTag: msg.DestinationAccountTag,
 			Source:                "sip:" + msg.FromUser + "@" + msg.FromHost,
 			Destination:           "sip:" + msg.ToUser + "@" + msg.ToHost,
+			SourceIP:              msg.SourceIP,
+			SourcePort:            msg.SourcePort,
+			DestinationIP:         msg.DestinationIP,
+			DestinationPort:       msg.DestinationPort,
+			CaptureAgentID:        msg.CaptureAgentID,
+			CaptureAgentName:      msg.CaptureAgentName,
+			Direction:             msg.Direction,
 			TimestampInvite:       msg.Timestamp,
 			CSeq:                  CSeqID,
 		}
@@ -86,7 +194,7 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 			l.WithFields(logrus.Fields{
 				"req-id":  reqID,
 				"source":  addr.String(),
-				"length":  len(packet),
+				"length":  length,
 				"method":  requestMethod,
 				"call-id": callID,
 				"ts":      msg.Timestamp,
@@ -103,23 +211,79 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 			l.WithFields(logrus.Fields{
 				"req-id":  reqID,
 				"source":  addr.String(),
-				"length":  len(packet),
+				"length":  length,
 				"method":  requestMethod,
 				"call-id": callID,
 				"ts":      msg.Timestamp,
 				"err":     errStr,
 			}).Error("unable to retrieve the call status, INVITE has not been received for this calls")
+			metrics.MessagesWithoutInvite.WithLabelValues(requestMethod).Inc()
 			return
 		}
 
-		if requestMethod == MethodAck {
+		if requestMethod == "" && msg.CseqMethod == MethodInvite && CSeqID == call.CSeq {
+			// the final failure responses end the call, which is kept until the ACK; the
+			// challenges and redirections only end the INVITE transaction, the caller
+			// retries it with a new CSeq
+			code, _ := strconv.Atoi(msg.FirstResp)
+			if isRetryResponse(code) && call.FinalCode == 0 && call.TimestampAck.IsZero() &&
+				s.transition(ctx, callID, metrics.MethodResponse, map[string]interface{}{
+					model.CallFieldFinalCode:    nil,
+					model.CallFieldTimestampAck: time.Time{},
+					model.CallFieldTimestampBye: time.Time{},
+				}, map[string]interface{}{
+					model.CallFieldFinalCode: code,
+				}, StateManagerTTLInvite) {
+				l.WithFields(logrus.Fields{
+					"req-id":  reqID,
+					"source":  addr.String(),
+					"length":  length,
+					"code":    code,
+					"call-id": callID,
+					"ts":      msg.Timestamp,
+				}).Debug("INVITE challenged or redirected, waiting for a new INVITE")
+			} else if code >= 300 && !isRetryResponse(code) && call.FinalCode == 0 && call.TimestampAck.IsZero() &&
+				s.transition(ctx, callID, metrics.MethodResponse, map[string]interface{}{
+					model.CallFieldFinalCode:    nil,
+					model.CallFieldTimestampAck: time.Time{},
+					model.CallFieldTimestampBye: time.Time{},
+				}, map[string]interface{}{
+					model.CallFieldFinalCode:    code,
+					model.CallFieldTimestampBye: msg.Timestamp,
+				}, StateManagerTTLInvite) {
+				call.FinalCode = code
+				call.TimestampBye = msg.Timestamp
+
+				if settings.PublishCDRs {
+					cdr = newCallDetailRecord(settings, &call, msg.Timestamp)
+				}
+
+				l.WithFields(logrus.Fields{
+					"req-id":  reqID,
+					"source":  addr.String(),
+					"length":  length,
+					"code":    code,
+					"call-id": callID,
+					"ts":      msg.Timestamp,
+				}).Debug("call failure detected")
+			}
+		} else if requestMethod == MethodAck && isRetryResponse(call.FinalCode) {
+			// the ACK of a challenge or a redirection, the call is kept for the new INVITE
+		} else if requestMethod == MethodAck && call.FinalCode >= 300 {
+			s.state.Delete(ctx, callID)
+		} else if requestMethod == MethodAck {
 			if CSeqID == call.CSeq && call.TimestampAck.IsZero() &&
-				(call.AccountTag != "" || call.DestinationAccountTag != "") {
+				(call.AccountTag != "" || call.DestinationAccountTag != "") &&
+				s.transition(ctx, callID, requestMethod, map[string]interface{}{
+					model.CallFieldTimestampAck: time.Time{},
+				}, map[string]interface{}{
+					model.CallFieldTimestampAck: msg.Timestamp,
+				}, StateManagerTTLCall) {
 				call.TimestampAck = msg.Timestamp
-				s.state.Set(ctx, call.TransactionTag, call, StateManagerTTLCall)
 
 				routingKey = rabbitmq.QueueNameBeginTransaction
 				req = &model.BeginTransaction{
+					SchemaVersion: model.TransactionSchemaVersion,
 					Request: model.BeginTransactionRequest{
 						Tenant:                call.Tenant,
 						TransactionTag:        call.TransactionTag,
@@ -127,39 +291,50 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 						DestinationAccountTag: call.DestinationAccountTag,
 						Source:                call.Source,
 						Destination:           call.Destination,
-						ProductTag:            productTag,
-						Tags:                  transactionTags,
+						CaptureAgentID:        call.CaptureAgentID,
+						CaptureAgentName:      call.CaptureAgentName,
+						Direction:             call.Direction,
+						ProductTag:            settings.ProductTag,
+						Tags:                  settings.TransactionTags,
 						TimestampBegin:        msg.Timestamp.UTC().Format(time.RFC3339),
 					},
+					CSeq: call.CSeq,
 				}
 
 				l.WithFields(logrus.Fields{
 					"req-id":  reqID,
 					"source":  addr.String(),
-					"length":  len(packet),
+					"length":  length,
 					"method":  requestMethod,
 					"call-id": callID,
 					"ts":      msg.Timestamp,
 				}).Debug("call start detected: begin transaction")
 			}
-		} else if requestMethod == MethodBye || requestMethod == MethodCancel {
+		} else if (requestMethod == MethodBye || requestMethod == MethodCancel) &&
+			s.transition(ctx, callID, requestMethod, map[string]interface{}{
+				model.CallFieldTimestampBye: time.Time{},
+			}, map[string]interface{}{
+				model.CallFieldTimestampBye: msg.Timestamp,
+			}, StateManagerTTLInvite) {
 			s.state.Delete(ctx, callID)
+			observeCallDuration(&call, msg.Timestamp)
 
 			routingKey = rabbitmq.QueueNameEndTransaction
-			req = &model.EndTransaction{
-				Request: model.EndTransactionRequest{
-					Tenant:                config.Config.GetString(dconfig.SettingTenant),
-					TransactionTag:        callID,
-					AccountTag:            call.AccountTag,
-					DestinationAccountTag: call.DestinationAccountTag,
-					TimestampEnd:          msg.Timestamp.UTC().Format(time.RFC3339),
-				},
+			req = newEndTransaction(settings.Tenant, &call, msg.Timestamp)
+
+			if settings.PublishCDRs {
+				if call.FinalCode == 0 && requestMethod == MethodCancel {
+					call.FinalCode = 487
+				} else if call.FinalCode == 0 {
+					call.FinalCode = 200
+				}
+				cdr = newCallDetailRecord(settings, &call, msg.Timestamp)
 			}
 
 			l.WithFields(logrus.Fields{
 				"req-id":  reqID,
 				"source":  addr.String(),
-				"length":  len(packet),
+				"length":  length,
 				"method":  requestMethod,
 				"call-id": callID,
 				"ts":      msg.Timestamp,
@@ -168,18 +343,171 @@ func (s *Server) handle(ctx context.Context, addr net.Addr, packet []byte) {
 	}
 
 	if req != nil {
-		err = s.client.Publish(ctx, routingKey, req)
+		err := s.publish(ctx, routingKey, req)
 		if err != nil {
 			l.WithFields(logrus.Fields{
 				"req-id":  reqID,
 				"source":  addr.String(),
-				"length":  len(packet),
+				"length":  length,
 				"method":  requestMethod,
 				"call-id": callID,
 				"err":     err.Error(),
 			}).Error("unable to publish the request")
+		}
+	}
+
+	if cdr != nil {
+		err := s.publish(ctx, rabbitmq.QueueNameCallDetailRecord, cdr)
+		if err != nil {
+			l.WithFields(logrus.Fields{
+				"req-id":  reqID,
+				"source":  addr.String(),
+				"length":  length,
+				"method":  requestMethod,
+				"call-id": callID,
+				"err":     err.Error(),
+			}).Error("unable to publish the call detail record")
+		}
+	}
+}
+
+// handleQualityReport aggregates the samples of an RTCP report in the quality of its
+// call; the aggregates are replaced atomically, retrying if another report updated
+// them concurrently
+func (s *Server) handleQualityReport(ctx context.Context, reqID uuid.UUID, addr net.Addr, length int, report *model.QualityReport) {
+	l := log.FromContext(ctx).WithFields(logrus.Fields{
+		"req-id":        reqID,
+		"source":        addr.String(),
+		"length":        length,
+		"capture-agent": report.CaptureAgentID,
+		"call-id":       report.CallID,
+	})
+
+	settings := s.getSettings()
+	if agent := settings.SIP.CaptureAgent(report.CaptureAgentID); agent != nil && !agent.Billing {
+		l.Debug("RTCP report not trusted for billing, skipping it")
+		return
+	} else if len(report.Samples) == 0 {
+		return
+	}
+
+	for i := 0; i < QualityUpdateAttempts; i++ {
+		var call model.Call
+		err := s.state.Get(ctx, report.CallID, &call)
+		if err != nil {
+			l.WithField("err", err.Error()).Error("unable to retrieve the call status")
+			return
+		} else if call.CSeq == "" {
+			metrics.QualityReports.WithLabelValues(metrics.QualityReportUnknownCall).Inc()
+			l.Debug("RTCP report of an unknown call, skipping it")
+			return
+		}
 
+		quality := &model.CallQuality{}
+		if call.Quality != nil {
+			*quality = *call.Quality
+		}
+		for _, sample := range report.Samples {
+			quality.Add(sample)
+		}
+		updated, err := s.state.UpdateIf(ctx, report.CallID, map[string]interface{}{
+			model.CallFieldQuality: call.Quality,
+		}, map[string]interface{}{
+			model.CallFieldQuality: quality,
+		}, 0)
+		if err != nil {
+			l.WithField("err", err.Error()).Error("unable to update the call quality")
+			return
+		} else if updated {
+			metrics.QualityReports.WithLabelValues(metrics.QualityReportAggregated).Inc()
+			l.Debug("RTCP report aggregated in the call quality")
 			return
 		}
 	}
+	metrics.QualityReports.WithLabelValues(metrics.QualityReportConflict).Inc()
+	l.Warn("unable to update the call quality, too many concurrent updates")
+}
+
+// isDuplicate returns whether the message was already seen in the window, counting
+// the duplicates per capture agent; the message is handled if the filter fails
+func (s *Server) isDuplicate(ctx context.Context, settings *dconfig.Settings, msg *model.SIPMessage) bool {
+	seen, err := s.dedup.Seen(ctx, dedup.Key(settings.Dedup.Key, msg))
+	if err != nil {
+		log.FromContext(ctx).WithFields(logrus.Fields{
+			"call-id": msg.CallID,
+			"err":     err.Error(),
+		}).Error("unable to check the duplicate messages")
+		return false
+	} else if seen {
+		metrics.DuplicateMessages.WithLabelValues(strconv.FormatUint(uint64(msg.CaptureAgentID), 10)).Inc()
+	}
+	return seen
+}
+
+// isRetryResponse returns whether a final response to the INVITE is a redirection or an
+// authentication challenge, which the caller follows with a new INVITE in the same call
+func isRetryResponse(code int) bool {
+	return (code >= 300 && code < 400) || code == 401 || code == 407
+}
+
+// transition atomically updates the fields of a call if the conditions are met,
+// returning whether the transition applies to this message; the transitions already
+// applied by another agent, or by a retransmission, are skipped
+func (s *Server) transition(ctx context.Context, callID string, method string, conditions, fields map[string]interface{}, ttl int) bool {
+	updated, err := s.state.UpdateIf(ctx, callID, conditions, fields, ttl)
+	if err != nil {
+		log.FromContext(ctx).WithFields(logrus.Fields{
+			"method":  method,
+			"call-id": callID,
+			"err":     err.Error(),
+		}).Error("unable to update the call status")
+		return false
+	} else if !updated {
+		metrics.SkippedTransitions.WithLabelValues(method).Inc()
+		log.FromContext(ctx).WithFields(logrus.Fields{
+			"method":  method,
+			"call-id": callID,
+		}).Debug("call status already updated, skipping the message")
+	}
+	return updated
+}
+
+// publish publishes a request through the client, counting the outcome
+func (s *Server) publish(ctx context.Context, routingKey string, req interface{}) error {
+	if err := s.client.Publish(ctx, routingKey, req); err != nil {
+		metrics.PublishFailures.WithLabelValues(routingKey).Inc()
+		return err
+	}
+	metrics.Published.WithLabelValues(routingKey).Inc()
+	return nil
+}
+
+// newEndTransaction returns the end transaction request of a call ended at the given time
+func newEndTransaction(tenant string, call *model.Call, timestamp time.Time) *model.EndTransaction {
+	return &model.EndTransaction{
+		SchemaVersion: model.TransactionSchemaVersion,
+		Request: model.EndTransactionRequest{
+			Tenant:                tenant,
+			TransactionTag:        call.TransactionTag,
+			AccountTag:            call.AccountTag,
+			DestinationAccountTag: call.DestinationAccountTag,
+			CaptureAgentID:        call.CaptureAgentID,
+			CaptureAgentName:      call.CaptureAgentName,
+			Direction:             call.Direction,
+			TimestampEnd:          timestamp.UTC().Format(time.RFC3339),
+			Quality:               call.Quality.Summary(),
+		},
+		CSeq: call.CSeq,
+	}
+}
+
+// newCallDetailRecord returns the consolidated record of a call ended at the given time
+func newCallDetailRecord(settings *dconfig.Settings, call *model.Call, timestamp time.Time) *model.CallDetailRecord {
+	return model.NewCallDetailRecord(call, timestamp, settings.ProductTag, settings.TransactionTags)
+}
+
+func observeCallDuration(call *model.Call, timestamp time.Time) {
+	if !call.TimestampAck.IsZero() {
+		metrics.CallDuration.Observe(timestamp.Sub(call.TimestampAck).Seconds())
+	}
 }
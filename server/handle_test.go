@@ -0,0 +1,495 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sipcapture/heplify-server/decoder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	mock_rabbitmq "github.com/canyanio/rating-agent-hep/client/rabbitmq/mock"
+	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/metrics"
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/schema"
+)
+
+// newHandleTestServer returns a server publishing the call detail records, with a
+// connected memory state manager and the mocked client
+func newHandleTestServer(t *testing.T, mockClient *mock_rabbitmq.Client) *Server {
+	settings := newTestSettings()
+	settings.PublishCDRs = true
+	settings.TransactionTags = []string{"tag1"}
+
+	srv := NewServer(settings)
+	srv.SetClient(mockClient)
+	err := srv.state.Connect(context.Background())
+	assert.Nil(t, err)
+	return srv
+}
+
+// readSIPPayload returns the SIP payload of a HEP packet from the testdata
+func readSIPPayload(t *testing.T, name string) string {
+	buff, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+	assert.Nil(t, err)
+	hep, err := decoder.DecodeHEP(buff)
+	assert.Nil(t, err)
+	return hep.Payload
+}
+
+// handleSIP handles a raw SIP message sent by the caller at the given time
+func handleSIP(t *testing.T, srv *Server, payload string, timestamp time.Time) {
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+	msg, err := srv.processor.ProcessSIP([]byte(payload), timestamp, src, dst)
+	assert.Nil(t, err)
+	srv.handleMessage(context.Background(), uuid.New(), src, len(payload), msg)
+}
+
+func TestHandleMissingCSeq(t *testing.T) {
+	invite := readSIPPayload(t, "hep-invite.bin")
+	invite = strings.Replace(invite, "CSeq: 1 INVITE\r\n", "", 1)
+
+	mockClient := &mock_rabbitmq.Client{}
+	srv := newHandleTestServer(t, mockClient)
+	ctx := context.Background()
+	src := &net.UDPAddr{IP: net.ParseIP("192.168.192.2"), Port: 5060}
+	dst := &net.UDPAddr{IP: net.ParseIP("192.168.192.5"), Port: 5060}
+
+	failures := testutil.ToFloat64(metrics.DecodeFailures.WithLabelValues(metrics.ListenerSIPUDP))
+	srv.handle(ctx, packet{addr: src, localAddr: dst, payload: []byte(invite), listener: metrics.ListenerSIPUDP})
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.DecodeFailures.WithLabelValues(metrics.ListenerSIPUDP)))
+
+	hep := &decoder.HEP{
+		Version:   2,
+		Protocol:  0x11,
+		SrcIP:     "192.168.192.2",
+		DstIP:     "192.168.192.5",
+		SrcPort:   5060,
+		DstPort:   5060,
+		Tsec:      1584176168,
+		ProtoType: model.HEPProtoTypeSIP,
+		NodeID:    1,
+		Payload:   invite,
+	}
+	buff, err := hep.Marshal()
+	assert.Nil(t, err)
+	failures = testutil.ToFloat64(metrics.DecodeFailures.WithLabelValues(metrics.ListenerUDP))
+	srv.handle(ctx, packet{addr: src, localAddr: dst, payload: buff, listener: metrics.ListenerUDP})
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.DecodeFailures.WithLabelValues(metrics.ListenerUDP)))
+
+	// a message without CSeq which reaches the handler is skipped
+	msg := model.SIPMessageFromHEP(hep, &dconfig.SIPSettings{})
+	assert.Nil(t, msg.Cseq)
+	srv.handleMessage(ctx, uuid.New(), src, len(invite), msg)
+
+	count, err := srv.state.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageCallDetailRecord(t *testing.T) {
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+		mock.AnythingOfType("*model.BeginTransaction")).Return(nil)
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction")).Return(nil)
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		&model.CallDetailRecord{
+			SchemaVersion:         model.CallDetailRecordSchemaVersion,
+			Tenant:                "default",
+			TransactionTag:        "1-18@192.168.192.2",
+			AccountTag:            "1000",
+			DestinationAccountTag: "39040123456",
+			Source:                "sip:1000@192.168.192.2",
+			Destination:           "sip:39040123456@anotherdomain.com",
+			SourceIP:              "192.168.192.2",
+			DestinationIP:         "192.168.192.5",
+			CaptureAgentID:        1,
+			ProductTag:            "VOICE",
+			Tags:                  []string{"tag1"},
+			TimestampInvite:       "2020-03-14T08:56:08Z",
+			TimestampAnswer:       "2020-03-14T08:56:08Z",
+			TimestampEnd:          "2020-03-14T08:56:09Z",
+			Duration:              1,
+			Disposition:           model.DispositionAnswered,
+			SIPFinalCode:          200,
+			CSeq:                  "1",
+		}).Return(nil)
+
+	srv := newHandleTestServer(t, mockClient)
+	for _, name := range []string{"hep-invite.bin", "hep-ack.bin", "hep-bye.bin"} {
+		buff, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+		assert.Nil(t, err)
+		msg, _, err := srv.processor.Process(buff)
+		assert.Nil(t, err)
+		srv.handleMessage(context.Background(), uuid.New(), &net.UDPAddr{}, len(buff), msg)
+	}
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageCallFailure(t *testing.T) {
+	invite := readSIPPayload(t, "hep-invite.bin")
+	ack := readSIPPayload(t, "hep-ack.bin")
+	busy := "SIP/2.0 486 Busy Here\r\n" +
+		"Via: SIP/2.0/UDP 192.168.192.2:5060;branch=z9hG4bK-18-1-0\r\n" +
+		"From: sipp <sip:1000@192.168.192.2:5060>;tag=1\r\n" +
+		"To: sut <sip:39040123456@anotherdomain.com:5060>;tag=1\r\n" +
+		"Call-ID: 1-18@192.168.192.2\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Length: 0\r\n\r\n"
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.MatchedBy(func(cdr *model.CallDetailRecord) bool {
+			return cdr.Disposition == model.DispositionBusy && cdr.SIPFinalCode == 486 &&
+				cdr.TimestampAnswer == "" && cdr.Duration == 0 &&
+				cdr.TimestampEnd == "2020-03-14T08:56:10Z"
+		})).Return(nil).Once()
+
+	srv := newHandleTestServer(t, mockClient)
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	handleSIP(t, srv, invite, ts)
+	handleSIP(t, srv, busy, ts.Add(2*time.Second))
+
+	// the call is kept until the ACK of the failure, which does not begin the transaction
+	count, err := srv.state.Count(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	handleSIP(t, srv, ack, ts.Add(2*time.Second))
+	count, err = srv.state.Count(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageCallChallenged(t *testing.T) {
+	invite := readSIPPayload(t, "hep-invite.bin")
+	ack := readSIPPayload(t, "hep-ack.bin")
+	bye := strings.Replace(readSIPPayload(t, "hep-bye.bin"), "CSeq: 2 BYE", "CSeq: 3 BYE", 1)
+	challenge := "SIP/2.0 407 Proxy Authentication Required\r\n" +
+		"Via: SIP/2.0/UDP 192.168.192.2:5060;branch=z9hG4bK-18-1-0\r\n" +
+		"From: sipp <sip:1000@192.168.192.2:5060>;tag=1\r\n" +
+		"To: sut <sip:39040123456@anotherdomain.com:5060>;tag=1\r\n" +
+		"Call-ID: 1-18@192.168.192.2\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Proxy-Authenticate: Digest realm=\"anotherdomain.com\", nonce=\"1\"\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	reinvite := strings.Replace(invite, "CSeq: 1 INVITE", "CSeq: 2 INVITE", 1)
+	ok := strings.Replace(strings.Replace(challenge, "407 Proxy Authentication Required", "200 OK", 1),
+		"CSeq: 1 INVITE", "CSeq: 2 INVITE", 1)
+	reack := strings.Replace(ack, "CSeq: 1 ACK", "CSeq: 2 ACK", 1)
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+		mock.MatchedBy(func(req *model.BeginTransaction) bool {
+			return req.CSeq == "2" && req.Request.TimestampBegin == "2020-03-14T08:56:12Z"
+		})).Return(nil).Once()
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction")).Return(nil).Once()
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.MatchedBy(func(cdr *model.CallDetailRecord) bool {
+			return cdr.Disposition == model.DispositionAnswered && cdr.SIPFinalCode == 200 &&
+				cdr.Duration == 60 && model.MessageID(cdr, rabbitmq.QueueNameCallDetailRecord) ==
+				"1-18@192.168.192.2:2:"+rabbitmq.QueueNameCallDetailRecord
+		})).Return(nil).Once()
+
+	srv := newHandleTestServer(t, mockClient)
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	handleSIP(t, srv, invite, ts)
+	handleSIP(t, srv, challenge, ts.Add(time.Second))
+	handleSIP(t, srv, ack, ts.Add(time.Second))
+
+	// the challenge ends neither the call nor the transaction
+	count, err := srv.state.Count(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	handleSIP(t, srv, reinvite, ts.Add(2*time.Second))
+	handleSIP(t, srv, ok, ts.Add(4*time.Second))
+	handleSIP(t, srv, reack, ts.Add(4*time.Second))
+	handleSIP(t, srv, bye, ts.Add(64*time.Second))
+
+	count, err = srv.state.Count(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageCallCancelled(t *testing.T) {
+	invite := readSIPPayload(t, "hep-invite.bin")
+	cancel := strings.Replace(strings.Replace(invite, "INVITE sip:", "CANCEL sip:", 1),
+		"CSeq: 1 INVITE", "CSeq: 1 CANCEL", 1)
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction")).Return(nil)
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.MatchedBy(func(cdr *model.CallDetailRecord) bool {
+			return cdr.Disposition == model.DispositionCancelled && cdr.SIPFinalCode == 487
+		})).Return(nil).Once()
+
+	srv := newHandleTestServer(t, mockClient)
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	handleSIP(t, srv, invite, ts)
+	handleSIP(t, srv, cancel, ts.Add(5*time.Second))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageDuplicateTransitions(t *testing.T) {
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+		mock.AnythingOfType("*model.BeginTransaction")).Return(nil).Once()
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction")).Return(nil).Once()
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.AnythingOfType("*model.CallDetailRecord")).Return(nil).Once()
+
+	// the ACK and the BYE are reported twice, as by two proxies
+	srv := newHandleTestServer(t, mockClient)
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	handleSIP(t, srv, readSIPPayload(t, "hep-invite.bin"), ts)
+	handleSIP(t, srv, readSIPPayload(t, "hep-ack.bin"), ts)
+	handleSIP(t, srv, readSIPPayload(t, "hep-ack.bin"), ts)
+
+	var call model.Call
+	srv.state.Get(context.Background(), "1-18@192.168.192.2", &call)
+	assert.Equal(t, ts, call.TimestampAck.UTC())
+
+	// the second BYE finds the call already ended
+	handleSIP(t, srv, readSIPPayload(t, "hep-bye.bin"), ts.Add(time.Second))
+	handleSIP(t, srv, readSIPPayload(t, "hep-bye.bin"), ts.Add(time.Second))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleMessageDuplicates(t *testing.T) {
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+		mock.AnythingOfType("*model.BeginTransaction")).Return(nil).Once()
+
+	settings := newTestSettings()
+	settings.Dedup.Window = time.Minute
+	srv := NewServer(settings)
+	srv.SetClient(mockClient)
+
+	// the INVITE and the ACK are reported twice by the same capture agent
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	for _, name := range []string{"hep-invite.bin", "hep-invite.bin", "hep-ack.bin", "hep-ack.bin"} {
+		handleSIP(t, srv, readSIPPayload(t, name), ts)
+	}
+
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.DuplicateMessages.WithLabelValues("0")))
+}
+
+func TestHandleMessageCaptureAgents(t *testing.T) {
+	var tests = []struct {
+		agent     dconfig.CaptureAgentSettings
+		published bool
+	}{
+		{dconfig.CaptureAgentSettings{ID: 1, Name: "edge-proxy", Billing: true}, true},
+		{dconfig.CaptureAgentSettings{ID: 1, Name: "edge-proxy"}, false},
+		{dconfig.CaptureAgentSettings{ID: 1, Name: "edge-proxy", Billing: true,
+			Addresses: []string{"192.168.192.5"}, Direction: dconfig.DirectionIngress}, true},
+		{dconfig.CaptureAgentSettings{ID: 1, Name: "edge-proxy", Billing: true,
+			Addresses: []string{"192.168.192.5"}, Direction: dconfig.DirectionEgress}, false},
+	}
+
+	for _, test := range tests {
+		mockClient := &mock_rabbitmq.Client{}
+		if test.published {
+			mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+				mock.MatchedBy(func(req *model.BeginTransaction) bool {
+					return req.Request.CaptureAgentID == 1 && req.Request.CaptureAgentName == "edge-proxy"
+				})).Return(nil).Once()
+			mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+				mock.MatchedBy(func(req *model.EndTransaction) bool {
+					return req.Request.CaptureAgentID == 1 && req.Request.CaptureAgentName == "edge-proxy"
+				})).Return(nil).Once()
+		}
+
+		settings := newTestSettings()
+		settings.SIP.CaptureAgents = []dconfig.CaptureAgentSettings{test.agent}
+		srv := NewServer(settings)
+		srv.SetClient(mockClient)
+		for _, name := range []string{"hep-invite.bin", "hep-ack.bin", "hep-bye.bin"} {
+			buff, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+			assert.Nil(t, err)
+			msg, _, err := srv.processor.Process(buff)
+			assert.Nil(t, err)
+			srv.handleMessage(context.Background(), uuid.New(), &net.UDPAddr{}, len(buff), msg)
+		}
+
+		mockClient.AssertExpectations(t)
+	}
+}
+
+func TestHandleMessageBillingDirection(t *testing.T) {
+	var tests = []struct {
+		addresses []string
+		billing   string
+		direction string
+		published bool
+	}{
+		{nil, "", "", true},
+		{[]string{"192.168.192.5"}, "", model.DirectionIngress, true},
+		{[]string{"192.168.192.5"}, dconfig.DirectionIngress, model.DirectionIngress, true},
+		{[]string{"192.168.192.2"}, dconfig.DirectionIngress, model.DirectionEgress, false},
+		{[]string{"192.168.192.2", "192.168.192.5"}, dconfig.DirectionInternal, model.DirectionInternal, true},
+	}
+
+	for _, test := range tests {
+		mockClient := &mock_rabbitmq.Client{}
+		if test.published {
+			mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+				mock.MatchedBy(func(req *model.BeginTransaction) bool {
+					return req.Request.Direction == test.direction
+				})).Return(nil).Once()
+			mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+				mock.MatchedBy(func(req *model.EndTransaction) bool {
+					return req.Request.Direction == test.direction
+				})).Return(nil).Once()
+		}
+
+		settings := newTestSettings()
+		settings.SIP.Addresses = test.addresses
+		settings.SIP.BillingDirection = test.billing
+		srv := NewServer(settings)
+		srv.SetClient(mockClient)
+		for _, name := range []string{"hep-invite.bin", "hep-ack.bin", "hep-bye.bin"} {
+			buff, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+			assert.Nil(t, err)
+			msg, _, err := srv.processor.Process(buff)
+			assert.Nil(t, err)
+			srv.handleMessage(context.Background(), uuid.New(), &net.UDPAddr{}, len(buff), msg)
+		}
+
+		mockClient.AssertExpectations(t)
+	}
+}
+
+func TestHandleQualityReport(t *testing.T) {
+	summary := &model.QualitySummary{
+		Samples:       3,
+		JitterAvg:     20,
+		JitterMax:     40,
+		PacketLossAvg: 1,
+		PacketLossMax: 3,
+		MOSAvg:        3.9,
+		MOSMin:        3.5,
+	}
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameBeginTransaction,
+		mock.AnythingOfType("*model.BeginTransaction")).Return(nil)
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameEndTransaction,
+		mock.MatchedBy(func(req *model.EndTransaction) bool {
+			return assert.ObjectsAreEqual(summary, req.Request.Quality)
+		})).Return(nil).Once()
+	mockClient.On("Publish", mock.Anything, rabbitmq.QueueNameCallDetailRecord,
+		mock.MatchedBy(func(cdr *model.CallDetailRecord) bool {
+			return assert.ObjectsAreEqual(summary, cdr.Quality)
+		})).Return(nil).Once()
+
+	srv := newHandleTestServer(t, mockClient)
+	ctx := context.Background()
+	invite := readSIPPayload(t, "hep-invite.bin")
+	ts := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	handleSIP(t, srv, invite, ts)
+	handleSIP(t, srv, readSIPPayload(t, "hep-ack.bin"), ts)
+
+	reports := []*model.QualityReport{
+		{CallID: "1-18@192.168.192.2", Samples: []model.QualitySample{
+			{Jitter: 10, PacketLoss: 0, MOS: 4.2},
+			{Jitter: 10, PacketLoss: 0, MOS: 4},
+		}},
+		{CallID: "1-18@192.168.192.2", Samples: []model.QualitySample{
+			{Jitter: 40, PacketLoss: 3, MOS: 3.5},
+		}},
+		{CallID: "unknown", Samples: []model.QualitySample{
+			{Jitter: 80, PacketLoss: 10, MOS: 2},
+		}},
+	}
+	unknown := testutil.ToFloat64(metrics.QualityReports.WithLabelValues(metrics.QualityReportUnknownCall))
+	for _, report := range reports {
+		srv.handleQualityReport(ctx, uuid.New(), &net.UDPAddr{}, 0, report)
+	}
+	assert.Equal(t, unknown+1, testutil.ToFloat64(metrics.QualityReports.WithLabelValues(metrics.QualityReportUnknownCall)))
+
+	handleSIP(t, srv, readSIPPayload(t, "hep-bye.bin"), ts.Add(time.Second))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestHandleQualityReportConcurrent(t *testing.T) {
+	mockClient := &mock_rabbitmq.Client{}
+	srv := newHandleTestServer(t, mockClient)
+	ctx := context.Background()
+	handleSIP(t, srv, readSIPPayload(t, "hep-invite.bin"), time.Now())
+
+	// the concurrent reports are retried, and at most a few exhaust the attempts
+	conflicts := testutil.ToFloat64(metrics.QualityReports.WithLabelValues(metrics.QualityReportConflict))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.handleQualityReport(ctx, uuid.New(), &net.UDPAddr{}, 0, &model.QualityReport{
+				CallID:  "1-18@192.168.192.2",
+				Samples: []model.QualitySample{{Jitter: 10, MOS: 4}},
+			})
+		}()
+	}
+	wg.Wait()
+
+	var call model.Call
+	err := srv.state.Get(ctx, "1-18@192.168.192.2", &call)
+	assert.Nil(t, err)
+	failed := testutil.ToFloat64(metrics.QualityReports.WithLabelValues(metrics.QualityReportConflict)) - conflicts
+	assert.Equal(t, 20, call.Quality.Samples+int(failed))
+}
+
+func TestHandleMessagePublishedSchema(t *testing.T) {
+	published := []string{}
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Publish", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		routingKey := args.String(1)
+		published = append(published, routingKey)
+
+		data, err := json.Marshal(args.Get(2))
+		assert.Nil(t, err)
+		assert.Nil(t, schema.Validate(routingKey, data))
+	}).Return(nil)
+
+	srv := newHandleTestServer(t, mockClient)
+	for _, name := range []string{"hep-invite.bin", "hep-ack.bin", "hep-bye.bin"} {
+		buff, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+		assert.Nil(t, err)
+		msg, _, err := srv.processor.Process(buff)
+		assert.Nil(t, err)
+		srv.handleMessage(context.Background(), uuid.New(), &net.UDPAddr{}, len(buff), msg)
+	}
+
+	assert.Equal(t, []string{
+		rabbitmq.QueueNameBeginTransaction,
+		rabbitmq.QueueNameEndTransaction,
+		rabbitmq.QueueNameCallDetailRecord,
+	}, published)
+}
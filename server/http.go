@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/canyanio/rating-agent-hep/metrics"
+)
+
+// Health check specific constants
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+	HealthCheckListeners    = "listeners"
+	HealthCheckStateManager = "state_manager"
+	HealthCheckMessageBus   = "message_bus"
+	HealthCheckTimeout      = 2 * time.Second
+)
+
+// HealthCheck is the result of the check of a single dependency
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health is the body of the health and readiness responses
+type Health struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// newHTTPHandler returns the handler of the HTTP server
+func (s *Server) newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc(AdminPathCalls, s.adminAuth(s.adminCalls))
+	mux.HandleFunc(AdminPathCalls+"/", s.adminAuth(s.adminCall))
+	return mux
+}
+
+// healthz reports the agent is alive
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, &Health{Status: HealthStatusOK})
+}
+
+// readyz reports the agent is ready to receive HEP packets: the listeners are bound,
+// the state manager is reachable and the channel to the message bus is open
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), HealthCheckTimeout)
+	defer cancel()
+
+	health := &Health{
+		Status: HealthStatusOK,
+		Checks: map[string]*HealthCheck{},
+	}
+	check := func(name string, err error) {
+		result := &HealthCheck{Status: HealthStatusOK}
+		if err != nil {
+			result.Status = HealthStatusUnavailable
+			result.Error = err.Error()
+			health.Status = HealthStatusUnavailable
+		}
+		health.Checks[name] = result
+	}
+
+	var errListeners error
+	if atomic.LoadInt32(&s.listening) == 0 {
+		errListeners = errNotListening
+	}
+	check(HealthCheckListeners, errListeners)
+	check(HealthCheckStateManager, s.state.Ping(ctx))
+	check(HealthCheckMessageBus, s.client.Ping(ctx))
+
+	writeHealth(w, health)
+}
+
+func writeHealth(w http.ResponseWriter, health *Health) {
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != HealthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mock_rabbitmq "github.com/canyanio/rating-agent-hep/client/rabbitmq/mock"
+)
+
+func TestServerMetrics(t *testing.T) {
+	cwd, _ := os.Getwd()
+
+	path := filepath.Join(cwd, "..", "testdata", "hep-invite.bin")
+	buffInvite, _ := ioutil.ReadFile(path)
+
+	// mock rabbitmq client
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Connect",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Close",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+
+	srv := NewServer(newTestSettings())
+	assert.NotNil(t, srv)
+
+	srv.SetClient(mockClient)
+
+	// get free UDP and TCP ports
+	udpPort, err := getFreeUDPPort()
+	assert.Nil(t, err)
+	listen := fmt.Sprintf("localhost:%d", udpPort)
+	srv.setListenUDP(listen)
+	srv.setListenTCP("")
+
+	tcpPort, err := getFreeTCPPort()
+	assert.Nil(t, err)
+	listenHTTP := fmt.Sprintf("localhost:%d", tcpPort)
+	srv.setListenHTTP(listenHTTP)
+
+	// start the server
+	go srv.Start()
+
+	// wait the server to start-up
+	time.Sleep(100 * time.Millisecond)
+
+	// send an INVITE and an invalid packet
+	raddr, err := net.ResolveUDPAddr("udp", listen)
+	assert.Nil(t, err)
+	conn, err := net.DialUDP("udp", nil, raddr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(buffInvite)
+	assert.Nil(t, err)
+	_, err = conn.Write([]byte("dummy"))
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	// the active calls are counted periodically
+	srv.updateActiveCalls(context.Background())
+
+	// scrape the metrics
+	res, err := http.Get("http://" + listenHTTP + "/metrics")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), `rating_agent_hep_packets_received_total{listener="udp"}`)
+	assert.Contains(t, string(body), `rating_agent_hep_decode_failures_total{listener="udp"}`)
+	assert.Contains(t, string(body), `rating_agent_hep_sip_messages_total{method="INVITE"}`)
+	assert.Contains(t, string(body), "rating_agent_hep_active_calls 1")
+	assert.Contains(t, string(body), "rating_agent_hep_handle_duration_seconds_count")
+
+	srv.Stop()
+}
+
+func TestServerReadiness(t *testing.T) {
+	// mock rabbitmq client
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Connect",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Close",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Ping",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+
+	srv := NewServer(newTestSettings())
+	assert.NotNil(t, srv)
+
+	srv.SetClient(mockClient)
+
+	// get free UDP and TCP ports
+	udpPort, err := getFreeUDPPort()
+	assert.Nil(t, err)
+	srv.setListenUDP(fmt.Sprintf("localhost:%d", udpPort))
+	srv.setListenTCP("")
+
+	tcpPort, err := getFreeTCPPort()
+	assert.Nil(t, err)
+	listenHTTP := fmt.Sprintf("localhost:%d", tcpPort)
+	srv.setListenHTTP(listenHTTP)
+
+	// start the server
+	go srv.Start()
+
+	// wait the server to start-up
+	time.Sleep(100 * time.Millisecond)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		res, err := http.Get("http://" + listenHTTP + path)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+		health := &Health{}
+		err = json.NewDecoder(res.Body).Decode(health)
+		res.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, HealthStatusOK, health.Status)
+	}
+
+	srv.Stop()
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestServerReadinessUnavailable(t *testing.T) {
+	// mock rabbitmq client
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Ping",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(errors.New("the channel is closed"))
+
+	srv := NewServer(newTestSettings())
+	assert.NotNil(t, srv)
+
+	srv.SetClient(mockClient)
+
+	w := httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	health := &Health{}
+	err := json.Unmarshal(w.Body.Bytes(), health)
+	assert.Nil(t, err)
+	assert.Equal(t, HealthStatusUnavailable, health.Status)
+	assert.Equal(t, &HealthCheck{Status: HealthStatusUnavailable, Error: errNotListening.Error()}, health.Checks[HealthCheckListeners])
+	assert.Equal(t, &HealthCheck{Status: HealthStatusOK}, health.Checks[HealthCheckStateManager])
+	assert.Equal(t, &HealthCheck{Status: HealthStatusUnavailable, Error: "the channel is closed"}, health.Checks[HealthCheckMessageBus])
+
+	// liveness does not depend on the dependencies
+	w = httptest.NewRecorder()
+	srv.newHTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/canyanio/rating-agent-hep/state"
+)
+
+// MigrateState moves the calls stored by the previous versions of the agent to the
+// current layout of the state manager, returning the number of migrated calls; the
+// migration stops when the agent receives the SIGINT or SIGTERM signal
+func (s *Server) MigrateState(ctx context.Context) (int, error) {
+	migrator, ok := s.state.(state.MigratorInterface)
+	if !ok {
+		return 0, errors.New("the state manager does not support the migration")
+	}
+
+	defer s.notifySignals()()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.state.Connect(ctx); err != nil {
+		return 0, err
+	}
+	defer s.state.Close(ctx)
+	return migrator.Migrate(ctx)
+}
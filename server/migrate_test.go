@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/model"
+)
+
+func TestServerMigrateState(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	settings := newTestSettings()
+	settings.StateManager = dconfig.StateManagerRedis
+	settings.Redis.KeyPrefix = "test-migrate:"
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     settings.Redis.Address,
+		Password: settings.Redis.Password,
+		DB:       settings.Redis.DB,
+	})
+	defer client.Close()
+	client.Set("1-18@192.168.192.2", `{"transaction_tag":"1-18@192.168.192.2","cseq":"1","account_tag":"1000"}`, time.Hour)
+
+	srv := NewServer(settings)
+	ctx := context.Background()
+	migrated, err := srv.MigrateState(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, migrated)
+
+	srv.state.Connect(ctx)
+	defer srv.state.Close(ctx)
+	var call model.Call
+	err = srv.state.Get(ctx, "1-18@192.168.192.2", &call)
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", call.AccountTag)
+	srv.state.Delete(ctx, "1-18@192.168.192.2")
+}
+
+func TestServerMigrateStateCanceled(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	settings := newTestSettings()
+	settings.StateManager = dconfig.StateManagerRedis
+	settings.Redis.KeyPrefix = "test-migrate:"
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     settings.Redis.Address,
+		Password: settings.Redis.Password,
+		DB:       settings.Redis.DB,
+	})
+	defer client.Close()
+	client.Set("1-18@192.168.192.2", `{"transaction_tag":"1-18@192.168.192.2","cseq":"1","account_tag":"1000"}`, time.Hour)
+	defer client.Del("1-18@192.168.192.2")
+
+	srv := NewServer(settings)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := srv.MigrateState(ctx)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestServerMigrateStateNotSupported(t *testing.T) {
+	srv := NewServer(newTestSettings())
+	_, err := srv.MigrateState(context.Background())
+	assert.EqualError(t, err, "the state manager does not support the migration")
+}
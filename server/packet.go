@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// packetReader reads the datagrams of a UDP listener with their source and
+// destination addresses
+type packetReader interface {
+	ReadFrom(b []byte) (n int, src, dst net.Addr, err error)
+}
+
+// localReader reads the datagrams of a UDP listener, their destination being the
+// local address of the listener
+type localReader struct {
+	net.PacketConn
+}
+
+func (r localReader) ReadFrom(b []byte) (int, net.Addr, net.Addr, error) {
+	n, src, err := r.PacketConn.ReadFrom(b)
+	return n, src, r.LocalAddr(), err
+}
+
+// ipv4Reader reads the destination of the datagrams from the IP_PKTINFO control messages
+type ipv4Reader struct {
+	*ipv4.PacketConn
+	local *net.UDPAddr
+}
+
+func (r ipv4Reader) ReadFrom(b []byte) (int, net.Addr, net.Addr, error) {
+	n, cm, src, err := r.PacketConn.ReadFrom(b)
+	if err != nil || cm == nil || cm.Dst == nil {
+		return n, src, r.local, err
+	}
+	return n, src, &net.UDPAddr{IP: cm.Dst, Port: r.local.Port}, nil
+}
+
+// ipv6Reader reads the destination of the datagrams from the IPV6_PKTINFO control
+// messages, which carry the IPv4-mapped destination on the dual-stack listeners
+type ipv6Reader struct {
+	*ipv6.PacketConn
+	local *net.UDPAddr
+}
+
+func (r ipv6Reader) ReadFrom(b []byte) (int, net.Addr, net.Addr, error) {
+	n, cm, src, err := r.PacketConn.ReadFrom(b)
+	if err != nil || cm == nil || cm.Dst == nil {
+		return n, src, r.local, err
+	}
+	return n, src, &net.UDPAddr{IP: cm.Dst, Port: r.local.Port}, nil
+}
+
+// newDestinationReader returns a reader of the datagrams of a UDP listener which
+// reports their actual destination, as the local address of the listeners bound to
+// the wildcard address is not; if the platform does not support the packet info
+// control messages, it falls back to the local address and returns the error
+func newDestinationReader(pc net.PacketConn) (packetReader, error) {
+	local, ok := pc.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return localReader{pc}, errors.New("unsupported address type")
+	}
+	if !local.IP.IsUnspecified() {
+		return localReader{pc}, nil
+	}
+	p6 := ipv6.NewPacketConn(pc)
+	if err := p6.SetControlMessage(ipv6.FlagDst, true); err == nil {
+		return ipv6Reader{PacketConn: p6, local: local}, nil
+	}
+	p4 := ipv4.NewPacketConn(pc)
+	if err := p4.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		return localReader{pc}, errors.Wrap(err, "unable to read the destination of the datagrams")
+	}
+	return ipv4Reader{PacketConn: p4, local: local}, nil
+}
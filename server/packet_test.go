@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDestinationReader(t *testing.T) {
+	for _, listen := range []string{":0", "0.0.0.0:0", "127.0.0.1:0"} {
+		pc, err := net.ListenPacket("udp", listen)
+		assert.Nil(t, err)
+		defer pc.Close()
+
+		reader, err := newDestinationReader(pc)
+		assert.Nil(t, err, listen)
+
+		port := pc.LocalAddr().(*net.UDPAddr).Port
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		assert.Nil(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("OPTIONS"))
+		assert.Nil(t, err)
+
+		buf := make([]byte, 16)
+		n, src, dst, err := reader.ReadFrom(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "OPTIONS", string(buf[:n]))
+		assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, src.(*net.UDPAddr).Port)
+		assert.Equal(t, (&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}).String(), dst.String(), listen)
+	}
+}
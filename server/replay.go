@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	uuid "github.com/google/uuid"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/canyanio/rating-agent-hep/metrics"
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/pcap"
+)
+
+var hepMagic = []byte("HEP3")
+
+var errReplayInterrupted = errors.New("replay interrupted")
+
+// Replay reads the UDP packets from a pcap or pcapng capture file and processes them
+// in order, as if they were received by the listeners; HEP packets keep the timestamp
+// set by the capture agent, while raw SIP messages get the capture timestamp; the
+// replay stops when the agent receives the SIGINT or SIGTERM signal
+func (s *Server) Replay(r io.Reader) error {
+	ctx := context.Background()
+	l := log.FromContext(ctx)
+
+	defer s.notifySignals()()
+
+	reader, err := pcap.NewReader(r)
+	if err != nil {
+		l.Error(err)
+		return err
+	}
+
+	if err := s.state.Connect(ctx); err != nil {
+		l.Error(err)
+		return err
+	}
+	defer s.state.Close(ctx)
+
+	if s.dedup != nil {
+		if err := s.dedup.Connect(ctx); err != nil {
+			l.Error(err)
+			return err
+		}
+		defer s.dedup.Close(ctx)
+	}
+
+	if err := s.client.Connect(ctx); err != nil {
+		l.Error(err)
+		return err
+	}
+	defer s.client.Close(ctx)
+
+	processed := 0
+	for {
+		select {
+		case <-s.quit:
+			l.Infof("Replay interrupted, %d messages processed", processed)
+			return errReplayInterrupted
+		default:
+		}
+
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			l.Error(err)
+			return err
+		}
+
+		reqID := uuid.New()
+		metrics.PacketsReceived.WithLabelValues(metrics.ListenerReplay).Inc()
+		msg, report, err := s.replayPacket(packet)
+		if err != nil {
+			metrics.DecodeFailures.WithLabelValues(metrics.ListenerReplay).Inc()
+			l.WithFields(logrus.Fields{
+				"req-id": reqID,
+				"source": packet.SrcAddr().String(),
+				"length": len(packet.Payload),
+				"ts":     packet.Timestamp,
+			}).Debug("skipping packet, neither HEP nor SIP")
+			continue
+		}
+
+		if report != nil {
+			s.handleQualityReport(ctx, reqID, packet.SrcAddr(), len(packet.Payload), report)
+		} else {
+			s.handleMessage(ctx, reqID, packet.SrcAddr(), len(packet.Payload), msg)
+		}
+		processed++
+	}
+
+	l.Infof("Replay completed, %d messages processed", processed)
+	return nil
+}
+
+func (s *Server) replayPacket(packet *pcap.Packet) (*model.SIPMessage, *model.QualityReport, error) {
+	if bytes.HasPrefix(packet.Payload, hepMagic) {
+		return s.processor.Process(packet.Payload)
+	}
+	msg, err := s.processor.ProcessSIP(packet.Payload, packet.Timestamp, packet.SrcAddr(), packet.DstAddr())
+	if err != nil {
+		// HEP packets can also be encapsulated using protobuf
+		if msg, report, errHEP := s.processor.Process(packet.Payload); errHEP == nil {
+			return msg, report, nil
+		}
+		return nil, nil, err
+	}
+	return msg, nil, nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sys/unix"
+
+	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
+	mock_rabbitmq "github.com/canyanio/rating-agent-hep/client/rabbitmq/mock"
+	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/dedup"
+	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/state"
+)
+
+func TestServerReplay(t *testing.T) {
+	for _, name := range []string{"hep.pcap", "sip.pcapng"} {
+		cwd, _ := os.Getwd()
+		f, err := os.Open(filepath.Join(cwd, "..", "testdata", name))
+		assert.Nil(t, err)
+		defer f.Close()
+
+		// mock rabbitmq client
+		mockClient := &mock_rabbitmq.Client{}
+		mockClient.On("Connect",
+			mock.MatchedBy(func(_ context.Context) bool {
+				return true
+			}),
+		).Return(nil)
+		mockClient.On("Close",
+			mock.MatchedBy(func(_ context.Context) bool {
+				return true
+			}),
+		).Return(nil)
+		mockClient.On("Publish",
+			mock.MatchedBy(func(_ context.Context) bool {
+				return true
+			}),
+			rabbitmq.QueueNameBeginTransaction,
+			mock.MatchedBy(func(req *model.BeginTransaction) bool {
+				assert.Equal(t, "2020-03-14T08:56:08Z", req.Request.TimestampBegin)
+				assert.Equal(t, "1000", req.Request.AccountTag)
+
+				return true
+			}),
+		).Return(nil).Once()
+		mockClient.On("Publish",
+			mock.MatchedBy(func(_ context.Context) bool {
+				return true
+			}),
+			rabbitmq.QueueNameEndTransaction,
+			mock.MatchedBy(func(req *model.EndTransaction) bool {
+				assert.Equal(t, "2020-03-14T08:56:09Z", req.Request.TimestampEnd)
+
+				return true
+			}),
+		).Return(nil).Once()
+
+		settings := newTestSettings()
+		settings.SIP.LocalDomains = []string{"192.168.192.2", "anotherdomain.com"}
+
+		srv := NewServer(settings)
+		assert.NotNil(t, srv)
+
+		srv.SetClient(mockClient)
+
+		err = srv.Replay(f)
+		assert.Nil(t, err, name)
+
+		mockClient.AssertExpectations(t)
+	}
+}
+
+func TestServerReplayInvalidFile(t *testing.T) {
+	cwd, _ := os.Getwd()
+	f, err := os.Open(filepath.Join(cwd, "..", "testdata", "hep-invite.bin"))
+	assert.Nil(t, err)
+	defer f.Close()
+
+	mockClient := &mock_rabbitmq.Client{}
+
+	srv := NewServer(newTestSettings())
+	assert.NotNil(t, srv)
+
+	srv.SetClient(mockClient)
+
+	err = srv.Replay(f)
+	assert.Error(t, err)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestServerReplayInterrupted(t *testing.T) {
+	cwd, _ := os.Getwd()
+	f, err := os.Open(filepath.Join(cwd, "..", "testdata", "hep.pcap"))
+	assert.Nil(t, err)
+	defer f.Close()
+
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Connect", mock.Anything).Return(nil)
+	mockClient.On("Close", mock.Anything).Return(nil)
+
+	srv := NewServer(newTestSettings())
+	srv.SetClient(mockClient)
+
+	srv.quit <- unix.SIGINT
+	err = srv.Replay(f)
+	assert.Equal(t, errReplayInterrupted, err)
+
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestServerSetDryRun(t *testing.T) {
+	settings := newTestSettings()
+	settings.StateManager = dconfig.StateManagerRedis
+	settings.Dedup.Window = 2 * time.Second
+
+	srv := NewServer(settings)
+	assert.IsType(t, &state.RedisManager{}, srv.state)
+	assert.IsType(t, &dedup.Shared{}, srv.dedup)
+
+	mockClient := &mock_rabbitmq.Client{}
+	srv.SetDryRun(mockClient)
+	assert.Equal(t, mockClient, srv.client)
+	assert.IsType(t, &state.MemoryManager{}, srv.state)
+	assert.IsType(t, &dedup.Local{}, srv.dedup)
+
+	settings.Dedup.Window = 0
+	srv = NewServer(settings)
+	srv.SetDryRun(mockClient)
+	assert.Nil(t, srv.dedup)
+}
@@ -2,21 +2,30 @@ package server
 
 import (
 	"context"
-	"errors"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
+	"time"
 
-	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 
 	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
 	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/dedup"
+	"github.com/canyanio/rating-agent-hep/metrics"
 	"github.com/canyanio/rating-agent-hep/processor"
 	"github.com/canyanio/rating-agent-hep/state"
 )
 
+// ActiveCallsInterval is the interval between the counts of the active calls
+const ActiveCallsInterval = 15 * time.Second
+
+var errNotListening = errors.New("the listeners are not bound")
+
 // Interface is the interface for Server objects
 type Interface interface {
 	Start() error
@@ -24,64 +33,104 @@ type Interface interface {
 
 // Server is the UDP/TCP server
 type Server struct {
-	processor processor.HEPProcessorInterface
-	state     state.ManagerInterface
-	client    rabbitmq.ClientInterface
-	listenUDP string
-	listenTCP string
-	quit      chan os.Signal
+	processor    processor.HEPProcessorInterface
+	state        state.ManagerInterface
+	dedup        dedup.Interface
+	client       rabbitmq.ClientInterface
+	settings     atomic.Value
+	listenUDP    string
+	listenTCP    string
+	listenSIPUDP string
+	listenHTTP   string
+	listening    int32
+	quit         chan os.Signal
+	reload       chan os.Signal
+	done         chan struct{}
 }
 
 // UDP/TCP packet received by the UDP/TCP server
 type packet struct {
-	addr    net.Addr
-	payload []byte
+	addr      net.Addr
+	localAddr net.Addr
+	payload   []byte
+	listener  string
 }
 
 // NewServer initializes a new UDP/TCP server
-func NewServer() *Server {
-	listenUDP := config.Config.GetString(dconfig.SettingListenUDP)
-	listenTCP := config.Config.GetString(dconfig.SettingListenTCP)
-	messagebusURI := config.Config.GetString(dconfig.SettingMessageBusURI)
-	stateManagerType := config.Config.GetString(dconfig.SettingStateManager)
-	redisAddress := config.Config.GetString(dconfig.SettingRedisAddress)
-	redisPassword := config.Config.GetString(dconfig.SettingRedisPassword)
-	redisDb := config.Config.GetInt(dconfig.SettingRedisDb)
-	return newServerWithConfig(
-		listenUDP,
-		listenTCP,
-		messagebusURI,
-		stateManagerType,
-		redisAddress,
-		redisPassword,
-		redisDb,
-	)
-}
-
-func newServerWithConfig(listenUDP, listenTCP, messagebusURI, stateManagerType, redisAddress, redisPassword string, redisDb int) *Server {
+func NewServer(settings *dconfig.Settings) *Server {
 	var stateManager state.ManagerInterface
-	if stateManagerType == dconfig.StateManagerRedis {
-		stateManager = state.NewRedisManager(redisAddress, redisPassword, redisDb)
-	} else {
+	switch settings.StateManager {
+	case dconfig.StateManagerRedis:
+		stateManager = state.NewRedisManagerWithOptions(newRedisOptions(settings, settings.Redis.KeyPrefix))
+	case dconfig.StateManagerFile:
+		stateManager = state.NewFileManager(settings.StateFile.Directory, settings.StateFile.Sync)
+	default:
 		stateManager = state.NewMemoryManager()
 	}
 
-	quit := make(chan os.Signal)
-	processor := processor.NewHEPProcessor()
-	client := rabbitmq.NewClient(messagebusURI)
+	// the duplicate messages are shared by the agents through Redis, in a key space
+	// distinct from the calls: the tenants starting with an underscore are reserved
+	var filter dedup.Interface
+	if settings.Dedup.Window > 0 && settings.StateManager == dconfig.StateManagerRedis {
+		filter = dedup.NewShared(state.NewRedisManagerWithOptions(
+			newRedisOptions(settings, settings.Redis.KeyPrefix+"_dedup:")), settings.Dedup.Window)
+	} else if settings.Dedup.Window > 0 {
+		filter = dedup.NewLocal(settings.Dedup.Window)
+	}
+
+	quit := make(chan os.Signal, 1)
+	reload := make(chan os.Signal, 1)
+	processor := processor.NewHEPProcessor(&settings.SIP)
+	client := newClient(settings)
 
-	signal.Notify(quit, unix.SIGINT, unix.SIGTERM)
+	s := &Server{
+		processor:    processor,
+		client:       client,
+		state:        stateManager,
+		dedup:        filter,
+		quit:         quit,
+		reload:       reload,
+		done:         make(chan struct{}),
+		listenUDP:    settings.ListenUDP,
+		listenTCP:    settings.ListenTCP,
+		listenSIPUDP: settings.ListenSIPUDP,
+		listenHTTP:   settings.ListenHTTP,
+	}
+	s.settings.Store(settings)
+	return s
+}
 
-	return &Server{
-		processor: processor,
-		client:    client,
-		state:     stateManager,
-		quit:      quit,
-		listenUDP: listenUDP,
-		listenTCP: listenTCP,
+// newRedisOptions returns the options of a Redis state manager storing its keys
+// with the given prefix
+func newRedisOptions(settings *dconfig.Settings, keyPrefix string) state.RedisOptions {
+	return state.RedisOptions{
+		KeyPrefix:             keyPrefix,
+		Namespace:             settings.Tenant,
+		Address:               settings.Redis.Address,
+		MasterName:            settings.Redis.SentinelMasterName,
+		SentinelAddresses:     settings.Redis.SentinelAddresses,
+		SentinelPassword:      settings.Redis.SentinelPassword,
+		ClusterAddresses:      settings.Redis.ClusterAddresses,
+		Username:              settings.Redis.Username,
+		Password:              settings.Redis.Password,
+		DB:                    settings.Redis.DB,
+		TLS:                   settings.Redis.TLS,
+		TLSCAFile:             settings.Redis.TLSCAFile,
+		TLSInsecureSkipVerify: settings.Redis.TLSInsecureSkipVerify,
+		PoolSize:              settings.Redis.PoolSize,
+		DialTimeout:           settings.Redis.DialTimeout,
+		ReadTimeout:           settings.Redis.ReadTimeout,
+		WriteTimeout:          settings.Redis.WriteTimeout,
+		ConnectRetries:        settings.Redis.ConnectRetries,
+		ConnectRetryBackoff:   settings.Redis.ConnectRetryBackoff,
 	}
 }
 
+// getSettings returns the settings currently in use
+func (s *Server) getSettings() *dconfig.Settings {
+	return s.settings.Load().(*dconfig.Settings)
+}
+
 func (s *Server) setListenUDP(listen string) {
 	s.listenUDP = listen
 }
@@ -90,8 +139,40 @@ func (s *Server) setListenTCP(listen string) {
 	s.listenTCP = listen
 }
 
-func (s *Server) setClient(c rabbitmq.ClientInterface) {
+func (s *Server) setListenSIPUDP(listen string) {
+	s.listenSIPUDP = listen
+}
+
+func (s *Server) setListenHTTP(listen string) {
+	s.listenHTTP = listen
+}
+
+// SetClient replaces the client used to publish the requests
+func (s *Server) SetClient(c rabbitmq.ClientInterface) {
+	s.client = c
+}
+
+// SetDryRun replaces the client used to publish the requests, and the state manager
+// and the duplicates filter with local ones, so that a dry run neither publishes the
+// requests nor alters the calls tracked by the running agents
+func (s *Server) SetDryRun(c rabbitmq.ClientInterface) {
 	s.client = c
+	s.state = state.NewMemoryManager()
+	s.dedup = nil
+	if window := s.getSettings().Dedup.Window; window > 0 {
+		s.dedup = dedup.NewLocal(window)
+	}
+}
+
+// notifySignals relays the termination and reload signals to the server, until the
+// returned function is called
+func (s *Server) notifySignals() func() {
+	signal.Notify(s.quit, unix.SIGINT, unix.SIGTERM)
+	signal.Notify(s.reload, unix.SIGHUP)
+	return func() {
+		signal.Stop(s.quit)
+		signal.Stop(s.reload)
+	}
 }
 
 // Start starts the UDP/TCP server which receives the HEP packats
@@ -99,12 +180,33 @@ func (s *Server) Start() error {
 	ctx := context.Background()
 	l := log.FromContext(ctx)
 
+	defer s.notifySignals()()
+
 	if err := s.state.Connect(ctx); err != nil {
 		l.Error(err)
 		return err
 	}
 	defer s.state.Close(ctx)
 
+	if s.dedup != nil {
+		if err := s.dedup.Connect(ctx); err != nil {
+			l.Error(err)
+			return err
+		}
+		defer s.dedup.Close(ctx)
+	}
+
+	countCtx, cancelCount := context.WithCancel(ctx)
+	counted := make(chan struct{})
+	go func() {
+		defer close(counted)
+		s.countActiveCalls(countCtx)
+	}()
+	defer func() {
+		cancelCount()
+		<-counted
+	}()
+
 	if err := s.client.Connect(ctx); err != nil {
 		l.Error(err)
 		return err
@@ -121,6 +223,7 @@ func (s *Server) Start() error {
 			l.Error(err)
 			return err
 		}
+		defer pc.Close()
 	}
 
 	listenTCP := s.listenTCP
@@ -133,30 +236,58 @@ func (s *Server) Start() error {
 			l.Error(err)
 			return err
 		}
+		defer li.Close()
+	}
+
+	listenSIPUDP := s.listenSIPUDP
+	var pcSIP net.PacketConn
+	if listenSIPUDP != "" {
+		l.Infof("Listening on udp:%v (raw SIP)", listenSIPUDP)
+		var err error
+		pcSIP, err = net.ListenPacket("udp", listenSIPUDP)
+		if err != nil {
+			l.Error(err)
+			return err
+		}
+		defer pcSIP.Close()
 	}
 
-	if listenUDP == "" && listenTCP == "" {
-		err := errors.New("neither listen_tcp nor listen_udp are set, exiting")
+	if listenUDP == "" && listenTCP == "" && listenSIPUDP == "" {
+		err := errors.New("neither listen_tcp, listen_udp nor listen_sip_udp are set, exiting")
 		l.Error(err)
 		return err
 	}
 
+	listenHTTP := s.listenHTTP
+	if listenHTTP != "" {
+		l.Infof("Listening on http:%v", listenHTTP)
+		lh, err := net.Listen("tcp", listenHTTP)
+		if err != nil {
+			l.Error(err)
+			return err
+		}
+		httpServer := &http.Server{
+			Handler: s.newHTTPHandler(),
+		}
+		go httpServer.Serve(lh)
+		defer httpServer.Close()
+	}
+
+	atomic.StoreInt32(&s.listening, 1)
+	defer atomic.StoreInt32(&s.listening, 0)
+
 	packets := make(chan packet)
 
 	if listenUDP != "" {
-		go func() {
-			for {
-				buf := make([]byte, 65536)
-				n, addr, err := pc.ReadFrom(buf)
-				if err != nil {
-					continue
-				}
-				packets <- packet{
-					addr:    addr,
-					payload: buf[:n],
-				}
-			}
-		}()
+		go s.readPackets(localReader{pc}, metrics.ListenerUDP, packets)
+	}
+
+	if listenSIPUDP != "" {
+		reader, err := newDestinationReader(pcSIP)
+		if err != nil {
+			l.Warn(errors.Wrap(err, "the destination of the raw SIP messages is the listen address"))
+		}
+		go s.readPackets(reader, metrics.ListenerSIPUDP, packets)
 	}
 
 	if listenTCP != "" {
@@ -164,18 +295,27 @@ func (s *Server) Start() error {
 			for {
 				conn, err := li.Accept()
 				if err != nil {
-					continue
+					if isTemporary(err) {
+						continue
+					}
+					return
 				}
 				go func() {
+					defer conn.Close()
 					for {
 						buf := make([]byte, 65536)
 						n, err := conn.Read(buf)
 						if err != nil {
 							return
 						}
-						packets <- packet{
-							addr:    conn.RemoteAddr(),
-							payload: buf[:n],
+						select {
+						case packets <- packet{
+							addr:     conn.RemoteAddr(),
+							payload:  buf[:n],
+							listener: metrics.ListenerTCP,
+						}:
+						case <-s.done:
+							return
 						}
 					}
 				}()
@@ -186,21 +326,101 @@ func (s *Server) Start() error {
 	for {
 		select {
 		case pkt := <-packets:
-			go s.handle(ctx, pkt.addr, pkt.payload)
+			go s.handle(ctx, pkt)
+			break
+
+		case <-s.reload:
+			s.reloadConfig(ctx)
 			break
 
 		case <-s.quit:
-			if listenUDP != "" {
-				pc.Close()
-			}
-			if listenTCP != "" {
-				li.Close()
-			}
+			close(s.done)
 			return nil
 		}
 	}
 }
 
+// countActiveCalls updates the number of calls tracked by the state manager every
+// ActiveCallsInterval, until the context is canceled
+func (s *Server) countActiveCalls(ctx context.Context) {
+	ticker := time.NewTicker(ActiveCallsInterval)
+	defer ticker.Stop()
+	for {
+		s.updateActiveCalls(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) updateActiveCalls(ctx context.Context) {
+	count, err := s.state.Count(ctx)
+	if err != nil {
+		log.FromContext(ctx).Error(errors.Wrap(err, "unable to count the active calls"))
+		return
+	}
+	metrics.ActiveCalls.Set(float64(count))
+}
+
+// readPackets reads the datagrams received by a UDP listener, until it is closed
+func (s *Server) readPackets(pc packetReader, listener string, packets chan<- packet) {
+	for {
+		buf := make([]byte, 65536)
+		n, addr, localAddr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if isTemporary(err) {
+				continue
+			}
+			return
+		}
+		select {
+		case packets <- packet{
+			addr:      addr,
+			localAddr: localAddr,
+			payload:   buf[:n],
+			listener:  listener,
+		}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func isTemporary(err error) bool {
+	if ne, ok := err.(net.Error); ok && ne.Temporary() {
+		return true
+	}
+	return false
+}
+
+// reloadConfig re-reads the configuration file and swaps the extraction and tagging
+// settings, leaving the listeners and the calls tracked by the state manager untouched
+func (s *Server) reloadConfig(ctx context.Context) {
+	l := log.FromContext(ctx)
+
+	reloaded, err := dconfig.Reload()
+	if err != nil {
+		l.Error(errors.Wrap(err, "unable to reload the configuration, keeping the current settings"))
+		return
+	}
+
+	current := s.getSettings()
+	changes := current.Diff(reloaded)
+	settings := current.WithReloadable(reloaded)
+	s.settings.Store(settings)
+	s.processor.SetSettings(&settings.SIP)
+
+	if len(changes) == 0 {
+		l.Info("configuration reloaded, no changes")
+		return
+	}
+	for _, change := range changes {
+		l.Infof("configuration reloaded, %s", change)
+	}
+}
+
 // Stop stops the UDP/TCP server
 func (s *Server) Stop() {
 	close(s.quit)
@@ -8,18 +8,27 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
-	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/go-redis/redis/v7"
 	"github.com/pkg/errors"
+	"github.com/sipcapture/heplify-server/decoder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/canyanio/rating-agent-hep/client/fanout"
+	"github.com/canyanio/rating-agent-hep/client/file"
+	"github.com/canyanio/rating-agent-hep/client/jetstream"
+	"github.com/canyanio/rating-agent-hep/client/kafka"
 	"github.com/canyanio/rating-agent-hep/client/rabbitmq"
 	mock_rabbitmq "github.com/canyanio/rating-agent-hep/client/rabbitmq/mock"
+	"github.com/canyanio/rating-agent-hep/client/webhook"
 	dconfig "github.com/canyanio/rating-agent-hep/config"
+	"github.com/canyanio/rating-agent-hep/dedup"
 	"github.com/canyanio/rating-agent-hep/model"
+	"github.com/canyanio/rating-agent-hep/state"
 )
 
 func getFreeUDPPort() (int, error) {
@@ -51,12 +60,111 @@ func getFreeTCPPort() (int, error) {
 }
 
 func TestNewServer(t *testing.T) {
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
+	assert.IsType(t, &rabbitmq.Client{}, srv.client)
+
+	settings := newTestSettings()
+	settings.MessageBusType = dconfig.MessageBusTypeKafka
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &kafka.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.MessageBusType = dconfig.MessageBusTypeNATS
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &jetstream.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.MessageBusType = dconfig.MessageBusTypeWebhook
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &webhook.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.MessageBusType = dconfig.MessageBusTypeFile
+	settings.FileSink.Path = "events.jsonl"
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &file.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.FileSink.Path = "events.jsonl"
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &fanout.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.Sinks.Names = []string{dconfig.MessageBusTypeKafka}
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &fanout.Client{}, srv.client)
+
+	settings = newTestSettings()
+	settings.StateManager = dconfig.StateManagerFile
+	settings.StateFile.Directory = "state"
+	srv = NewServer(settings)
+	assert.NotNil(t, srv)
+	assert.IsType(t, &state.FileManager{}, srv.state)
+	assert.Nil(t, srv.dedup)
+
+	settings = newTestSettings()
+	settings.Dedup.Window = 2 * time.Second
+	srv = NewServer(settings)
+	assert.IsType(t, &dedup.Local{}, srv.dedup)
+
+	settings.StateManager = dconfig.StateManagerRedis
+	srv = NewServer(settings)
+	assert.IsType(t, &state.RedisManager{}, srv.state)
+	assert.IsType(t, &dedup.Shared{}, srv.dedup)
+}
+
+func TestServerDedupKeySpace(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	settings := newTestSettings()
+	settings.StateManager = dconfig.StateManagerRedis
+	settings.Redis.KeyPrefix = "test-dedup:"
+	settings.Tenant = "dedup"
+	settings.Dedup.Window = 2 * time.Second
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     settings.Redis.Address,
+		Password: settings.Redis.Password,
+		DB:       settings.Redis.DB,
+	})
+	defer client.Close()
+	cleanup := func() {
+		keys, _ := client.Keys(settings.Redis.KeyPrefix + "*").Result()
+		if len(keys) > 0 {
+			client.Del(keys...)
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	ctx := context.Background()
+	srv := NewServer(settings)
+	assert.Nil(t, srv.state.Connect(ctx))
+	defer srv.state.Close(ctx)
+	assert.Nil(t, srv.dedup.Connect(ctx))
+	defer srv.dedup.Close(ctx)
+
+	seen, err := srv.dedup.Seen(ctx, "key")
+	assert.Nil(t, err)
+	assert.False(t, seen)
+
+	// the keys of the duplicate messages are not calls, whatever the tenant
+	count, err := srv.state.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
 }
 
 func TestServerStartWithoutListenTCPorListenUDP(t *testing.T) {
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
 	srv.setListenTCP("")
@@ -73,7 +181,7 @@ func TestServerStartWithoutListenTCPorListenUDP(t *testing.T) {
 			return true
 		}),
 	).Return(nil)
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	err := srv.Start()
 	assert.NotNil(t, err)
@@ -127,10 +235,10 @@ func TestServerStartTCP(t *testing.T) {
 	).Return(nil)
 
 	// new UDP server with mocked client
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// get a free UDP port
 	tcpPort, err := getFreeTCPPort()
@@ -224,10 +332,10 @@ func TestServerStart(t *testing.T) {
 	).Return(nil)
 
 	// new UDP server with mocked client
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// get a free UDP port
 	udpPort, err := getFreeUDPPort()
@@ -323,24 +431,15 @@ func TestServerStartWithRedis(t *testing.T) {
 	listen := fmt.Sprintf("localhost:%d", udpPort)
 
 	// new UDP server with mocked processor and redis state manager
-	stateManagerType := "redis"
-	messagebusURI := config.Config.GetString(dconfig.SettingMessageBusURI)
-	redisAddress := config.Config.GetString(dconfig.SettingRedisAddress)
-	redisPassword := config.Config.GetString(dconfig.SettingRedisPassword)
-	redisDb := config.Config.GetInt(dconfig.SettingRedisDb)
-
-	srv := newServerWithConfig(
-		listen,
-		"",
-		messagebusURI,
-		stateManagerType,
-		redisAddress,
-		redisPassword,
-		redisDb,
-	)
+	settings := newTestSettings()
+	settings.ListenUDP = listen
+	settings.ListenTCP = ""
+	settings.StateManager = dconfig.StateManagerRedis
+
+	srv := NewServer(settings)
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// start the server
 	go srv.Start()
@@ -414,10 +513,10 @@ func TestServerStartPublishFailure(t *testing.T) {
 	).Return(errors.New("generic error"))
 
 	// new UDP server with mocked client
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// get a free UDP port
 	udpPort, err := getFreeUDPPort()
@@ -477,10 +576,10 @@ func TestServerStartAckWithoutInvite(t *testing.T) {
 	).Return(nil)
 
 	// new UDP server with mocked client
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// get a free UDP port
 	udpPort, err := getFreeUDPPort()
@@ -531,10 +630,10 @@ func TestServerStartAckErrorInProcessing(t *testing.T) {
 	).Return(nil)
 
 	// new UDP server with mocked client
-	srv := NewServer()
+	srv := NewServer(newTestSettings())
 	assert.NotNil(t, srv)
 
-	srv.setClient(mockClient)
+	srv.SetClient(mockClient)
 
 	// get a free UDP port
 	udpPort, err := getFreeUDPPort()
@@ -567,3 +666,123 @@ func TestServerStartAckErrorInProcessing(t *testing.T) {
 	// assert expectations (processor)
 	mockClient.AssertExpectations(t)
 }
+
+func TestServerReloadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "config-*.yaml")
+	assert.Nil(t, err)
+
+	defer syscall.Unlink(f.Name())
+
+	configFile := "sip_local_domains: [\"192.168.192.2\", \"anotherdomain.com\"]\n"
+	ioutil.WriteFile(f.Name(), []byte(configFile), 0644)
+
+	settings, err := dconfig.Init(f.Name())
+	assert.Nil(t, err)
+
+	srv := NewServer(settings)
+	assert.NotNil(t, srv)
+
+	ctx := context.Background()
+
+	// valid configuration, the new settings are applied
+	ioutil.WriteFile(f.Name(), []byte(configFile+"product_tag: DATA\nlisten_udp: \":5060\"\n"), 0644)
+	srv.reloadConfig(ctx)
+	assert.Equal(t, "DATA", srv.getSettings().ProductTag)
+	assert.Equal(t, []string{"192.168.192.2", "anotherdomain.com"}, srv.getSettings().SIP.LocalDomains)
+	assert.Equal(t, settings.ListenUDP, srv.getSettings().ListenUDP)
+	assert.Equal(t, dconfig.SettingProductTagDefault, settings.ProductTag)
+
+	// invalid configuration, the current settings are kept
+	ioutil.WriteFile(f.Name(), []byte("sip_local_domains: [\"canyan.io\"]\nproduct_tag: SMS\n"+
+		"account_tag_match_regexp: \"([0-9]+\"\n"), 0644)
+	srv.reloadConfig(ctx)
+	assert.Equal(t, "DATA", srv.getSettings().ProductTag)
+	assert.Equal(t, []string{"192.168.192.2", "anotherdomain.com"}, srv.getSettings().SIP.LocalDomains)
+}
+
+func TestServerStartRawSIP(t *testing.T) {
+	cwd, _ := os.Getwd()
+
+	payloads := [][]byte{}
+	for _, name := range []string{"hep-invite.bin", "hep-ack.bin", "hep-bye.bin"} {
+		buff, _ := ioutil.ReadFile(filepath.Join(cwd, "..", "testdata", name))
+		hep, err := decoder.DecodeHEP(buff)
+		assert.Nil(t, err)
+		payloads = append(payloads, []byte(hep.Payload))
+	}
+
+	// mock rabbitmq client
+	mockClient := &mock_rabbitmq.Client{}
+	mockClient.On("Connect",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Close",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Publish",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+		rabbitmq.QueueNameBeginTransaction,
+		mock.MatchedBy(func(req *model.BeginTransaction) bool {
+			assert.Equal(t, "1000", req.Request.AccountTag)
+
+			return true
+		}),
+	).Return(nil)
+	mockClient.On("Publish",
+		mock.MatchedBy(func(_ context.Context) bool {
+			return true
+		}),
+		rabbitmq.QueueNameEndTransaction,
+		mock.AnythingOfType("*model.EndTransaction"),
+	).Return(nil)
+
+	// get a free UDP port
+	udpPort, err := getFreeUDPPort()
+	assert.Nil(t, err)
+	listen := fmt.Sprintf("localhost:%d", udpPort)
+
+	// new raw SIP server with mocked client
+	settings := newTestSettings()
+	settings.ListenUDP = ""
+	settings.ListenTCP = ""
+	settings.ListenSIPUDP = listen
+	settings.SIP.LocalDomains = []string{"192.168.192.2", "anotherdomain.com"}
+
+	srv := NewServer(settings)
+	assert.NotNil(t, srv)
+
+	srv.SetClient(mockClient)
+
+	// start the server
+	go srv.Start()
+
+	// wait the server to start-up
+	time.Sleep(100 * time.Millisecond)
+
+	// connect to the server
+	raddr, err := net.ResolveUDPAddr("udp", listen)
+	assert.Nil(t, err)
+	conn, err := net.DialUDP("udp", nil, raddr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// write the SIP messages
+	for _, payload := range payloads {
+		bytes, err := conn.Write(payload)
+		assert.Nil(t, err)
+		assert.Equal(t, len(payload), bytes)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// wait the server to process the packet, then shut it down
+	srv.Stop()
+
+	// assert expectations (processor)
+	mockClient.AssertExpectations(t)
+}
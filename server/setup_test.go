@@ -8,11 +8,27 @@ import (
 	"github.com/canyanio/rating-agent-hep/config"
 )
 
+var testSettings *config.Settings
+
 func TestMain(m *testing.M) {
 	flag.Parse()
+	configPath := ""
 	if !testing.Short() {
-		config.Init("config.test.yml")
+		configPath = "config.test.yml"
+	}
+	settings, err := config.Init(configPath)
+	if err != nil {
+		panic(err)
 	}
+	testSettings = settings
 	result := m.Run()
 	os.Exit(result)
 }
+
+// newTestSettings returns a copy of the test settings, which the caller can modify;
+// the HTTP listener is disabled to avoid binding the default port
+func newTestSettings() *config.Settings {
+	settings := *testSettings
+	settings.ListenHTTP = ""
+	return &settings
+}
@@ -2,13 +2,64 @@ package state
 
 import (
 	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
 )
 
 // ManagerInterface describes a state manager object
 type ManagerInterface interface {
 	Connect(context context.Context) error
 	Close(context context.Context) error
+	Ping(context context.Context) error
 	Set(context context.Context, key string, req interface{}, ttl int) error
+	SetIfNotExists(context context.Context, key string, req interface{}, ttl int) (bool, error)
+	Update(context context.Context, key string, fields map[string]interface{}, ttl int) error
+	UpdateIf(context context.Context, key string, conditions, fields map[string]interface{}, ttl int) (bool, error)
 	Get(context context.Context, key string, destination interface{}) error
 	Delete(context context.Context, key string) error
+	Count(context context.Context) (int, error)
+	Scan(context context.Context, fn ScanFunc) error
+}
+
+// MigratorInterface is implemented by the state managers which can migrate the
+// state stored by the previous versions of the agent
+type MigratorInterface interface {
+	Migrate(context context.Context) (int, error)
+}
+
+// ScanFunc is called by Scan for each key and its associated data, the scan
+// stops if it returns an error
+type ScanFunc func(key string, data []byte) error
+
+// updateJSON returns a JSON object with some of its fields replaced, if the other
+// fields are equal to the conditions, where nil matches the missing fields; it
+// returns whether the conditions are met
+func updateJSON(dataJSON []byte, conditions, fields map[string]interface{}) ([]byte, bool, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(dataJSON, &object); err != nil || object == nil {
+		return nil, false, errors.New("unable to update the fields of a value which is not an object")
+	}
+	for field, value := range conditions {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "unable to marshal request to JSON")
+		}
+		current, ok := object[field]
+		if !ok {
+			current = json.RawMessage("null")
+		}
+		if string(current) != string(valueJSON) {
+			return dataJSON, false, nil
+		}
+	}
+	for field, value := range fields {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "unable to marshal request to JSON")
+		}
+		object[field] = valueJSON
+	}
+	updated, err := json.Marshal(object)
+	return updated, true, err
 }
@@ -0,0 +1,391 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// File state manager constants
+const (
+	// FileManagerLogName is the name of the append-only log in the state directory
+	FileManagerLogName = "state.log"
+	// FileManagerCompactionMinRecords is the minimum number of stale records, that is
+	// overwritten or deleted keys, which triggers the compaction of the log
+	FileManagerCompactionMinRecords = 1000
+)
+
+// fileRecord is a line of the append-only log; deleted keys are written as tombstones
+type fileRecord struct {
+	Key     string          `json:"key"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Expires int64           `json:"expires,omitempty"`
+	Deleted bool            `json:"deleted,omitempty"`
+}
+
+type fileEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+func (e fileEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// FileManager is the embedded state manager: the keys are kept in memory and each
+// change is appended to a log in a local directory, which is replayed on Connect so
+// that the state survives a restart; the log is compacted when the stale records
+// outnumber the live keys
+type FileManager struct {
+	directory string
+	sync      bool
+	file      *os.File
+	store     map[string]fileEntry
+	stale     int
+	mutex     sync.RWMutex
+	now       func() time.Time
+}
+
+// NewFileManager returns a new File Manager object storing the log in a directory;
+// if sync is set, the log is flushed to the disk after each change
+func NewFileManager(directory string, sync bool) *FileManager {
+	return &FileManager{
+		directory: directory,
+		sync:      sync,
+		store:     make(map[string]fileEntry),
+		now:       time.Now,
+	}
+}
+
+// Connect replays and compacts the log, and opens it for appending
+func (m *FileManager) Connect(context context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.directory, 0755); err != nil {
+		return errors.Wrap(err, "unable to create the state directory")
+	}
+	if err := m.load(context); err != nil {
+		return err
+	}
+	return m.compact()
+}
+
+// Close flushes and closes the log
+func (m *FileManager) Close(context context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return errors.New("not connected")
+	}
+	err := m.file.Sync()
+	if errClose := m.file.Close(); err == nil {
+		err = errClose
+	}
+	m.file = nil
+	return errors.Wrap(err, "unable to close the state log")
+}
+
+// Ping checks the log is open
+func (m *FileManager) Ping(context context.Context) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.file == nil {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// Set updates the data associated with a key, which expires after ttl seconds if
+// greater than zero
+func (m *FileManager) Set(context context.Context, key string, data interface{}, ttl int) error {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal request to JSON")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.setLocked(context, key, dataJSON, ttl, time.Time{})
+}
+
+// setLocked stores the data of a key, which expires after ttl seconds if greater than
+// zero, at the given time otherwise
+func (m *FileManager) setLocked(ctx context.Context, key string, dataJSON []byte, ttl int, expires time.Time) error {
+	entry := fileEntry{data: dataJSON, expires: expires}
+	if ttl > 0 {
+		entry.expires = m.now().Add(time.Duration(ttl) * time.Second)
+	}
+	record := &fileRecord{Key: key, Data: dataJSON}
+	if !entry.expires.IsZero() {
+		record.Expires = entry.expires.Unix()
+	}
+	if err := m.append(record); err != nil {
+		return err
+	}
+
+	if _, ok := m.store[key]; ok {
+		m.stale++
+	}
+	m.store[key] = entry
+	m.maybeCompact(ctx)
+	return nil
+}
+
+// SetIfNotExists atomically sets the data associated with a key, if it does not
+// exist, returning whether the data was set
+func (m *FileManager) SetIfNotExists(context context.Context, key string, data interface{}, ttl int) (bool, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to marshal request to JSON")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if entry, ok := m.store[key]; ok && !entry.expired(m.now()) {
+		return false, nil
+	}
+	return true, m.setLocked(context, key, dataJSON, ttl, time.Time{})
+}
+
+// Update updates some fields of the data associated with a key, if it exists, and
+// sets its expiration if ttl is greater than zero
+func (m *FileManager) Update(context context.Context, key string, fields map[string]interface{}, ttl int) error {
+	_, err := m.UpdateIf(context, key, nil, fields, ttl)
+	return err
+}
+
+// UpdateIf atomically updates some fields of the data associated with a key, if it
+// exists and the conditions are met, returning whether the data was updated
+func (m *FileManager) UpdateIf(context context.Context, key string, conditions, fields map[string]interface{}, ttl int) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.store[key]
+	if !ok || entry.expired(m.now()) {
+		return false, nil
+	}
+	dataJSON, ok, err := updateJSON(entry.data, conditions, fields)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, m.setLocked(context, key, dataJSON, ttl, entry.expires)
+}
+
+// Get retrives the data associated with a key
+func (m *FileManager) Get(context context.Context, key string, destination interface{}) error {
+	m.mutex.RLock()
+	entry, ok := m.store[key]
+	m.mutex.RUnlock()
+	if !ok || entry.expired(m.now()) {
+		return nil
+	}
+	err := json.Unmarshal(entry.data, destination)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal request to JSON")
+	}
+	return nil
+}
+
+// Delete deletes a key and its associated data
+func (m *FileManager) Delete(context context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.store[key]; !ok {
+		return nil
+	}
+	if err := m.append(&fileRecord{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	delete(m.store, key)
+	m.stale += 2
+	m.maybeCompact(context)
+	return nil
+}
+
+// Count returns the number of keys
+func (m *FileManager) Count(context context.Context) (int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	now := m.now()
+	count := 0
+	for _, entry := range m.store {
+		if !entry.expired(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Scan calls fn for each key and its associated data
+func (m *FileManager) Scan(context context.Context, fn ScanFunc) error {
+	m.mutex.RLock()
+	now := m.now()
+	store := make(map[string][]byte, len(m.store))
+	for key, entry := range m.store {
+		if !entry.expired(now) {
+			store[key] = entry.data
+		}
+	}
+	m.mutex.RUnlock()
+
+	for key, dataJSON := range store {
+		if err := fn(key, dataJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *FileManager) path() string {
+	return filepath.Join(m.directory, FileManagerLogName)
+}
+
+// load replays the log; the lines which cannot be decoded, such as the last one
+// written partially before a crash, are skipped
+func (m *FileManager) load(ctx context.Context) error {
+	f, err := os.Open(m.path())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "unable to open the state log")
+	}
+	defer f.Close()
+
+	l := log.FromContext(ctx)
+	now := m.now()
+	reader := bufio.NewReader(f)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		} else if err != nil && err != io.EOF {
+			return errors.Wrap(err, "unable to read the state log")
+		}
+
+		record := &fileRecord{}
+		if errDecode := json.Unmarshal(line, record); errDecode != nil || record.Key == "" {
+			l.WithFields(logrus.Fields{
+				"path": m.path(),
+				"line": lineNumber,
+			}).Warn("skipping a corrupted record of the state log")
+		} else if record.Deleted {
+			delete(m.store, record.Key)
+		} else {
+			entry := fileEntry{data: record.Data}
+			if record.Expires > 0 {
+				entry.expires = time.Unix(record.Expires, 0)
+			}
+			if entry.expired(now) {
+				delete(m.store, record.Key)
+			} else {
+				m.store[record.Key] = entry
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return nil
+}
+
+// compact rewrites the log with the live keys only, replacing the previous one
+// atomically, and opens it for appending
+func (m *FileManager) compact() error {
+	tmpPath := m.path() + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to create the state log")
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	now := m.now()
+	for key, entry := range m.store {
+		if entry.expired(now) {
+			delete(m.store, key)
+			continue
+		}
+		record := &fileRecord{Key: key, Data: entry.data}
+		if !entry.expires.IsZero() {
+			record.Expires = entry.expires.Unix()
+		}
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, m.path())
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "unable to compact the state log")
+	}
+	if dir, err := os.Open(m.directory); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	f, err := os.OpenFile(m.path(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to open the state log")
+	}
+	if m.file != nil {
+		m.file.Close()
+	}
+	m.file = f
+	m.stale = 0
+	return nil
+}
+
+// maybeCompact compacts the log when the stale records outnumber the live keys; the
+// failures are logged, the change being already persisted
+func (m *FileManager) maybeCompact(ctx context.Context) {
+	if m.stale < FileManagerCompactionMinRecords || m.stale <= len(m.store) {
+		return
+	}
+	if err := m.compact(); err != nil {
+		log.FromContext(ctx).Error(err)
+	}
+}
+
+// append writes a record to the log with a single write, so that a crash leaves
+// at most a partial last line
+func (m *FileManager) append(record *fileRecord) error {
+	if m.file == nil {
+		return errors.New("not connected")
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal request to JSON")
+	}
+	if _, err := m.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "unable to write the state log")
+	}
+	if m.sync {
+		if err := m.file.Sync(); err != nil {
+			return errors.Wrap(err, "unable to write the state log")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package state
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileManager(t *testing.T) (*FileManager, func()) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err)
+	mgr := NewFileManager(dir, true)
+	err = mgr.Connect(context.Background())
+	assert.Nil(t, err)
+	return mgr, func() {
+		mgr.Close(context.Background())
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileManagerGetSetDelete(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var ret string
+	err := mgr.Get(ctx, "key", &ret)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ret)
+
+	err = mgr.Set(ctx, "key", "TEST", 0)
+	assert.Nil(t, err)
+
+	err = mgr.Get(ctx, "key", &ret)
+	assert.Nil(t, err)
+	assert.Equal(t, "TEST", ret)
+
+	err = mgr.Delete(ctx, "key")
+	assert.Nil(t, err)
+
+	ret = ""
+	err = mgr.Get(ctx, "key", &ret)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ret)
+
+	err = mgr.Ping(ctx)
+	assert.Nil(t, err)
+}
+
+func TestFileManagerTTL(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	mgr.now = func() time.Time { return now }
+
+	mgr.Set(ctx, "key1", 1, 10)
+	mgr.Set(ctx, "key2", 2, 0)
+
+	count, err := mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	now = now.Add(10 * time.Second)
+
+	var ret int
+	err = mgr.Get(ctx, "key1", &ret)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ret)
+
+	count, err = mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	found := map[string]string{}
+	err = mgr.Scan(ctx, func(key string, data []byte) error {
+		found[key] = string(data)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key2": "2"}, found)
+
+	err = mgr.Scan(ctx, func(key string, data []byte) error {
+		return errors.New("stop")
+	})
+	assert.EqualError(t, err, "stop")
+}
+
+func TestFileManagerUpdate(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	mgr.now = func() time.Time { return now }
+
+	err := mgr.Update(ctx, "key", map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+
+	mgr.Set(ctx, "key", map[string]interface{}{"cseq": "1"}, 10)
+	err = mgr.Update(ctx, "key", map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(10*time.Second), mgr.store["key"].expires)
+
+	err = mgr.Update(ctx, "key", map[string]interface{}{"timestamp_ack": now}, 3600)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Hour), mgr.store["key"].expires)
+
+	// the updates are persisted
+	mgr.Close(ctx)
+	err = mgr.Connect(ctx)
+	assert.Nil(t, err)
+
+	ret := map[string]interface{}{}
+	mgr.Get(ctx, "key", &ret)
+	assert.Equal(t, map[string]interface{}{
+		"cseq":          "1",
+		"final_code":    float64(486),
+		"timestamp_ack": "2020-03-14T08:56:08Z",
+	}, ret)
+}
+
+func TestFileManagerUpdateIf(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mgr.Set(ctx, "key", map[string]interface{}{"cseq": "1"}, 0)
+	updated, err := mgr.UpdateIf(ctx, "key", map[string]interface{}{"final_code": nil},
+		map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	updated, err = mgr.UpdateIf(ctx, "key", map[string]interface{}{"final_code": nil},
+		map[string]interface{}{"final_code": 487}, 0)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	// the records of the skipped updates are not appended
+	data, err := ioutil.ReadFile(filepath.Join(mgr.directory, FileManagerLogName))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestFileManagerSetIfNotExists(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	mgr.now = func() time.Time { return now }
+
+	set, err := mgr.SetIfNotExists(ctx, "key", 1, 2)
+	assert.Nil(t, err)
+	assert.True(t, set)
+
+	set, err = mgr.SetIfNotExists(ctx, "key", 2, 2)
+	assert.Nil(t, err)
+	assert.False(t, set)
+
+	// the expired keys are set again
+	now = now.Add(2 * time.Second)
+	set, err = mgr.SetIfNotExists(ctx, "key", 3, 2)
+	assert.Nil(t, err)
+	assert.True(t, set)
+
+	var ret int
+	mgr.Get(ctx, "key", &ret)
+	assert.Equal(t, 3, ret)
+}
+
+func TestFileManagerRecovery(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mgr.Set(ctx, "key1", 1, 0)
+	mgr.Set(ctx, "key2", 2, 3600)
+	mgr.Set(ctx, "key1", 3, 0)
+	mgr.Set(ctx, "key3", 4, 0)
+	mgr.Delete(ctx, "key3")
+	err := mgr.Close(ctx)
+	assert.Nil(t, err)
+
+	// simulate a crash while writing the last record
+	f, err := os.OpenFile(filepath.Join(mgr.directory, FileManagerLogName), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	f.WriteString(`{"key":"key4","da`)
+	f.Close()
+
+	mgr = NewFileManager(mgr.directory, false)
+	err = mgr.Connect(ctx)
+	assert.Nil(t, err)
+
+	count, err := mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	var ret int
+	mgr.Get(ctx, "key1", &ret)
+	assert.Equal(t, 3, ret)
+	mgr.Get(ctx, "key2", &ret)
+	assert.Equal(t, 2, ret)
+
+	// the log is compacted when connecting
+	data, err := ioutil.ReadFile(filepath.Join(mgr.directory, FileManagerLogName))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	assert.NotContains(t, string(data), "key4")
+
+	// the new records are appended after the compacted ones
+	mgr.Set(ctx, "key4", 5, 0)
+	mgr.Close(ctx)
+	mgr = NewFileManager(mgr.directory, false)
+	err = mgr.Connect(ctx)
+	assert.Nil(t, err)
+	mgr.Get(ctx, "key4", &ret)
+	assert.Equal(t, 5, ret)
+}
+
+func TestFileManagerCompaction(t *testing.T) {
+	mgr, cleanup := newTestFileManager(t)
+	defer cleanup()
+	ctx := context.Background()
+	mgr.sync = false
+
+	mgr.Set(ctx, "key", 0, 0)
+	for i := 1; i < FileManagerCompactionMinRecords; i++ {
+		mgr.Set(ctx, "key", i, 0)
+	}
+	assert.Equal(t, FileManagerCompactionMinRecords-1, mgr.stale)
+
+	mgr.Set(ctx, "key", FileManagerCompactionMinRecords, 0)
+	assert.Equal(t, 0, mgr.stale)
+
+	data, err := ioutil.ReadFile(filepath.Join(mgr.directory, FileManagerLogName))
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"key\":\"key\",\"data\":1000}\n", string(data))
+}
+
+func TestFileManagerNotConnected(t *testing.T) {
+	mgr := NewFileManager("state", false)
+	ctx := context.Background()
+
+	err := mgr.Ping(ctx)
+	assert.EqualError(t, err, "not connected")
+
+	err = mgr.Set(ctx, "key", 1, 0)
+	assert.EqualError(t, err, "not connected")
+
+	err = mgr.Close(ctx)
+	assert.EqualError(t, err, "not connected")
+}
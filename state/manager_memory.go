@@ -3,6 +3,7 @@ package state
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -10,6 +11,7 @@ import (
 // MemoryManager is the Memory state manager
 type MemoryManager struct {
 	store map[string]interface{}
+	mutex sync.RWMutex
 }
 
 // NewMemoryManager returns a new Memory Manager objecft
@@ -30,19 +32,67 @@ func (m *MemoryManager) Close(context context.Context) error {
 	return nil
 }
 
+// Ping checks the memory is reachable
+func (m *MemoryManager) Ping(context context.Context) error {
+	return nil
+}
+
 // Set updates the data associated with a key
 func (m *MemoryManager) Set(context context.Context, key string, data interface{}, ttl int) error {
 	dataJSON, err := json.Marshal(data)
 	if err != nil {
 		return errors.Wrap(err, "unable to marshal request to JSON")
 	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.store[key] = dataJSON
 	return nil
 }
 
+// SetIfNotExists atomically sets the data associated with a key, if it does not
+// exist, returning whether the data was set
+func (m *MemoryManager) SetIfNotExists(context context.Context, key string, data interface{}, ttl int) (bool, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to marshal request to JSON")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.store[key]; ok {
+		return false, nil
+	}
+	m.store[key] = dataJSON
+	return true, nil
+}
+
+// Update updates some fields of the data associated with a key, if it exists
+func (m *MemoryManager) Update(context context.Context, key string, fields map[string]interface{}, ttl int) error {
+	_, err := m.UpdateIf(context, key, nil, fields, ttl)
+	return err
+}
+
+// UpdateIf atomically updates some fields of the data associated with a key, if it
+// exists and the conditions are met, returning whether the data was updated
+func (m *MemoryManager) UpdateIf(context context.Context, key string, conditions, fields map[string]interface{}, ttl int) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	dataJSON := m.store[key]
+	if dataJSON == nil {
+		return false, nil
+	}
+	updated, ok, err := updateJSON(dataJSON.([]byte), conditions, fields)
+	if err != nil || !ok {
+		return false, err
+	}
+	m.store[key] = updated
+	return true, nil
+}
+
 // Get retrives the data associated with a key
 func (m *MemoryManager) Get(context context.Context, key string, destination interface{}) error {
+	m.mutex.RLock()
 	dataJSON := m.store[key]
+	m.mutex.RUnlock()
 	if dataJSON == nil {
 		return nil
 	}
@@ -55,6 +105,32 @@ func (m *MemoryManager) Get(context context.Context, key string, destination int
 
 // Delete deletes a key and its associated data
 func (m *MemoryManager) Delete(context context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	delete(m.store, key)
 	return nil
 }
+
+// Count returns the number of keys
+func (m *MemoryManager) Count(context context.Context) (int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.store), nil
+}
+
+// Scan calls fn for each key and its associated data
+func (m *MemoryManager) Scan(context context.Context, fn ScanFunc) error {
+	m.mutex.RLock()
+	store := make(map[string][]byte, len(m.store))
+	for key, dataJSON := range m.store {
+		store[key] = dataJSON.([]byte)
+	}
+	m.mutex.RUnlock()
+
+	for key, dataJSON := range store {
+		if err := fn(key, dataJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package state
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -65,3 +69,132 @@ func TestMemoryManagerGetSetDeleteString(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "", ret)
 }
+
+func TestMemoryManagerCount(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+
+	count, err := mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	mgr.Set(ctx, "key1", 1, 0)
+	mgr.Set(ctx, "key2", 2, 0)
+
+	count, err = mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemoryManagerPing(t *testing.T) {
+	mgr := NewMemoryManager()
+	err := mgr.Ping(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestMemoryManagerScan(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+
+	mgr.Set(ctx, "key1", 1, 0)
+	mgr.Set(ctx, "key2", 2, 0)
+
+	found := map[string]string{}
+	err := mgr.Scan(ctx, func(key string, data []byte) error {
+		found[key] = string(data)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key1": "1", "key2": "2"}, found)
+
+	err = mgr.Scan(ctx, func(key string, data []byte) error {
+		return errors.New("stop")
+	})
+	assert.EqualError(t, err, "stop")
+}
+
+func TestMemoryManagerUpdate(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+
+	err := mgr.Update(ctx, "key", map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	count, _ := mgr.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	mgr.Set(ctx, "key", map[string]interface{}{"cseq": "1"}, 0)
+	err = mgr.Update(ctx, "key", map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+
+	ret := map[string]interface{}{}
+	mgr.Get(ctx, "key", &ret)
+	assert.Equal(t, map[string]interface{}{"cseq": "1", "final_code": float64(486)}, ret)
+
+	mgr.Set(ctx, "key", 1, 0)
+	err = mgr.Update(ctx, "key", map[string]interface{}{"final_code": 486}, 0)
+	assert.EqualError(t, err, "unable to update the fields of a value which is not an object")
+}
+
+func TestMemoryManagerUpdateIf(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+
+	updated, err := mgr.UpdateIf(ctx, "key", nil, map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	mgr.Set(ctx, "key", map[string]interface{}{"cseq": "1"}, 0)
+	conditions := map[string]interface{}{"cseq": "1", "final_code": nil}
+	updated, err = mgr.UpdateIf(ctx, "key", conditions, map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	updated, err = mgr.UpdateIf(ctx, "key", conditions, map[string]interface{}{"final_code": 487}, 0)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	ret := map[string]interface{}{}
+	mgr.Get(ctx, "key", &ret)
+	assert.Equal(t, map[string]interface{}{"cseq": "1", "final_code": float64(486)}, ret)
+}
+
+func TestMemoryManagerUpdateIfConcurrent(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+	mgr.Set(ctx, "key", map[string]interface{}{"timestamp_ack": time.Time{}}, 0)
+
+	var updates int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updated, err := mgr.UpdateIf(ctx, "key",
+				map[string]interface{}{"timestamp_ack": time.Time{}},
+				map[string]interface{}{"timestamp_ack": time.Now()}, 0)
+			assert.Nil(t, err)
+			if updated {
+				atomic.AddInt32(&updates, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), updates)
+}
+
+func TestMemoryManagerSetIfNotExists(t *testing.T) {
+	mgr := NewMemoryManager()
+	ctx := context.Background()
+
+	set, err := mgr.SetIfNotExists(ctx, "key", 1, 0)
+	assert.Nil(t, err)
+	assert.True(t, set)
+
+	set, err = mgr.SetIfNotExists(ctx, "key", 2, 0)
+	assert.Nil(t, err)
+	assert.False(t, set)
+
+	var ret int
+	mgr.Get(ctx, "key", &ret)
+	assert.Equal(t, 1, ret)
+}
@@ -2,45 +2,179 @@ package state
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
+	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+// Redis state manager constants
+const (
+	// RedisScanCount is the number of keys requested to Redis for each SCAN iteration
+	RedisScanCount = 100
+	// RedisMaxConnectRetryBackoff is the maximum delay between two connection attempts
+	RedisMaxConnectRetryBackoff = 30 * time.Second
+	// RedisValueField is the field of the hashes storing the values which are not JSON objects
+	RedisValueField = "_value"
+)
+
+// RedisOptions are the options of the Redis state manager; the manager connects to
+// the master monitored by the sentinels if MasterName is set, to the cluster if
+// ClusterAddresses is set, and to the server at Address otherwise
+type RedisOptions struct {
+	// KeyPrefix and Namespace, usually the tenant, are prepended to the keys as
+	// <prefix><namespace>:<key>, so that several agents and applications can share
+	// the same database
+	KeyPrefix             string
+	Namespace             string
+	Address               string
+	MasterName            string
+	SentinelAddresses     []string
+	SentinelPassword      string
+	ClusterAddresses      []string
+	Username              string
+	Password              string
+	DB                    int
+	TLS                   bool
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+	PoolSize              int
+	DialTimeout           time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	// ConnectRetries is the number of retries after the first failed connection attempt
+	ConnectRetries int
+	// ConnectRetryBackoff is the delay before the first retry, doubled at each retry
+	ConnectRetryBackoff time.Duration
+}
+
 // RedisManager is the Redis state manager
 type RedisManager struct {
-	client        *redis.Client
-	redisAddress  string
-	redisPassword string
-	redisDb       int
+	client  redis.UniversalClient
+	options RedisOptions
 }
 
 // NewRedisManager returns a new Redis Manager objecft
 func NewRedisManager(redisAddress, redisPassword string, redisDb int) *RedisManager {
+	return NewRedisManagerWithOptions(RedisOptions{
+		Address:  redisAddress,
+		Password: redisPassword,
+		DB:       redisDb,
+	})
+}
+
+// NewRedisManagerWithOptions returns a new Redis Manager object
+func NewRedisManagerWithOptions(options RedisOptions) *RedisManager {
 	return &RedisManager{
-		redisAddress:  redisAddress,
-		redisPassword: redisPassword,
-		redisDb:       redisDb,
+		options: options,
 	}
 }
 
-// Connect connects to Redis
+// Connect connects to Redis, retrying with exponential backoff
 func (m *RedisManager) Connect(context context.Context) error {
-	client := redis.NewClient(&redis.Options{
-		Addr:     m.redisAddress,
-		Password: m.redisPassword, // no password set
-		DB:       m.redisDb,       // use default DB
-	})
-	_, err := client.Ping().Result()
+	client, err := m.newClient()
 	if err != nil {
-		return errors.Wrap(err, "unable to connect to redis")
+		return err
+	}
+
+	backoff := m.options.ConnectRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = client.Ping().Err()
+		if err == nil {
+			break
+		}
+		if attempt >= m.options.ConnectRetries {
+			client.Close()
+			return errors.Wrap(err, "unable to connect to redis")
+		}
+
+		log.FromContext(context).WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"err":     err.Error(),
+		}).Warn("unable to connect to redis, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-context.Done():
+			client.Close()
+			return errors.Wrap(context.Err(), "unable to connect to redis")
+		}
+		backoff *= 2
+		if backoff > RedisMaxConnectRetryBackoff {
+			backoff = RedisMaxConnectRetryBackoff
+		}
 	}
 	m.client = client
 	return nil
 }
 
+// newClient returns the client of the standalone, sentinel or cluster deployment
+func (m *RedisManager) newClient() (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if m.options.TLS {
+		tlsConfig = &tls.Config{
+			InsecureSkipVerify: m.options.TLSInsecureSkipVerify,
+		}
+		if m.options.TLSCAFile != "" {
+			ca, err := ioutil.ReadFile(m.options.TLSCAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to read the redis CA file")
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, errors.Errorf("no certificates found in the redis CA file: %s", m.options.TLSCAFile)
+			}
+		}
+	}
+
+	switch {
+	case m.options.MasterName != "":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       m.options.MasterName,
+			SentinelAddrs:    m.options.SentinelAddresses,
+			SentinelPassword: m.options.SentinelPassword,
+			Username:         m.options.Username,
+			Password:         m.options.Password,
+			DB:               m.options.DB,
+			PoolSize:         m.options.PoolSize,
+			DialTimeout:      m.options.DialTimeout,
+			ReadTimeout:      m.options.ReadTimeout,
+			WriteTimeout:     m.options.WriteTimeout,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case len(m.options.ClusterAddresses) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        m.options.ClusterAddresses,
+			Username:     m.options.Username,
+			Password:     m.options.Password,
+			PoolSize:     m.options.PoolSize,
+			DialTimeout:  m.options.DialTimeout,
+			ReadTimeout:  m.options.ReadTimeout,
+			WriteTimeout: m.options.WriteTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:         m.options.Address,
+		Username:     m.options.Username,
+		Password:     m.options.Password,
+		DB:           m.options.DB,
+		PoolSize:     m.options.PoolSize,
+		DialTimeout:  m.options.DialTimeout,
+		ReadTimeout:  m.options.ReadTimeout,
+		WriteTimeout: m.options.WriteTimeout,
+		TLSConfig:    tlsConfig,
+	}), nil
+}
+
 // Close disconnects from Redis
 func (m *RedisManager) Close(context context.Context) error {
 	if m.client == nil {
@@ -51,25 +185,128 @@ func (m *RedisManager) Close(context context.Context) error {
 	return err
 }
 
-// Set updates the data associated with a key
+// Ping checks the Redis server is reachable
+func (m *RedisManager) Ping(context context.Context) error {
+	if m.client == nil {
+		return errors.New("not connected")
+	}
+	return m.client.Ping().Err()
+}
+
+// Set replaces the data associated with a key; the fields of the JSON objects are
+// stored as the fields of a hash, the other values in the RedisValueField field
 func (m *RedisManager) Set(context context.Context, key string, data interface{}, ttl int) error {
-	dataJSON, err := json.Marshal(data)
+	values, err := hashValues(data)
 	if err != nil {
-		return errors.Wrap(err, "unable to marshal request to JSON")
+		return err
 	}
-	err = m.client.Set(key, dataJSON, time.Duration(ttl)*time.Second).Err()
+	return m.setHash(m.key(key), values, time.Duration(ttl)*time.Second)
+}
+
+func (m *RedisManager) setHash(key string, values map[string]interface{}, ttl time.Duration) error {
+	_, err := m.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(key)
+		pipe.HSet(key, values)
+		if ttl > 0 {
+			pipe.PExpire(key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// SetIfNotExists atomically sets the data associated with a key, if it does not
+// exist, returning whether the data was set
+func (m *RedisManager) SetIfNotExists(context context.Context, key string, data interface{}, ttl int) (bool, error) {
+	values, err := hashValues(data)
+	if err != nil {
+		return false, err
+	}
+	args := []interface{}{ttl}
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	set, err := redisSetIfNotExistsScript.Run(m.client, []string{m.key(key)}, args...).Int()
+	return set == 1, err
+}
+
+// redisSetIfNotExistsScript sets the fields of a hash and its expiration, if it does
+// not exist; the arguments are the TTL and the names and values of the fields
+var redisSetIfNotExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call("HSET", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+if tonumber(ARGV[1]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// Update updates some fields of the data associated with a key, if it exists, and
+// sets its expiration if ttl is greater than zero
+func (m *RedisManager) Update(context context.Context, key string, fields map[string]interface{}, ttl int) error {
+	_, err := m.UpdateIf(context, key, nil, fields, ttl)
 	return err
 }
 
+// UpdateIf atomically updates some fields of the data associated with a key, if it
+// exists and the conditions are met, returning whether the data was updated; the
+// conditions are checked by a Lua script, so that only one of the agents sharing
+// the database updates the data
+func (m *RedisManager) UpdateIf(context context.Context, key string, conditions, fields map[string]interface{}, ttl int) (bool, error) {
+	args := []interface{}{ttl, len(conditions)}
+	for _, values := range []map[string]interface{}{conditions, fields} {
+		for field, value := range values {
+			valueJSON, err := json.Marshal(value)
+			if err != nil {
+				return false, errors.Wrap(err, "unable to marshal request to JSON")
+			}
+			args = append(args, field, valueJSON)
+		}
+	}
+	updated, err := redisUpdateScript.Run(m.client, []string{m.key(key)}, args...).Int()
+	return updated == 1, err
+}
+
+// redisUpdateScript sets the fields of an existing hash and its expiration, if the
+// conditions are met; the arguments are the TTL, the number of conditions, and the
+// names and values of the conditions and of the fields
+var redisUpdateScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local fields = 3 + 2 * tonumber(ARGV[2])
+for i = 3, fields - 1, 2 do
+	local value = redis.call("HGET", KEYS[1], ARGV[i])
+	if value == false then
+		value = "null"
+	end
+	if value ~= ARGV[i + 1] then
+		return 0
+	end
+end
+for i = fields, #ARGV, 2 do
+	redis.call("HSET", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+if tonumber(ARGV[1]) > 0 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
 // Get retrives the data associated with a key
 func (m *RedisManager) Get(context context.Context, key string, destination interface{}) error {
-	dataJSON, err := m.client.Get(key).Result()
-	if err == redis.Nil {
-		return nil
-	} else if err != nil {
+	values, err := m.client.HGetAll(m.key(key)).Result()
+	if err != nil {
 		return err
 	}
-	err = json.Unmarshal([]byte(dataJSON), destination)
+	if len(values) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(hashJSON(values), destination)
 	if err != nil {
 		return errors.Wrap(err, "unable to marshal request to JSON")
 	}
@@ -78,11 +315,193 @@ func (m *RedisManager) Get(context context.Context, key string, destination inte
 
 // Delete deletes a key and its associated data
 func (m *RedisManager) Delete(context context.Context, key string) error {
-	err := m.client.Del(key).Err()
+	err := m.client.Del(m.key(key)).Err()
 	return err
 }
 
-// Delete deletes a key and its associated data
-func (m *RedisManager) flushAll(context context.Context) {
-	m.client.FlushAll()
+// Count returns the number of keys of the namespace
+func (m *RedisManager) Count(context context.Context) (int, error) {
+	if m.client == nil {
+		return 0, errors.New("not connected")
+	}
+	var mutex sync.Mutex
+	count := 0
+	err := m.forEachNode(func(client redis.Cmdable) error {
+		iter := client.Scan(0, m.pattern(), RedisScanCount).Iterator()
+		for iter.Next() {
+			mutex.Lock()
+			count++
+			mutex.Unlock()
+		}
+		return iter.Err()
+	})
+	return count, err
+}
+
+// Scan calls fn for each key of the namespace and its associated data; on a cluster,
+// the keys of each master are scanned in turn
+func (m *RedisManager) Scan(context context.Context, fn ScanFunc) error {
+	if m.client == nil {
+		return errors.New("not connected")
+	}
+	var mutex sync.Mutex
+	return m.forEachNode(func(client redis.Cmdable) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return m.scan(client, fn)
+	})
+}
+
+func (m *RedisManager) scan(client redis.Cmdable, fn ScanFunc) error {
+	prefix := m.key("")
+	iter := client.Scan(0, m.pattern(), RedisScanCount).Iterator()
+	for iter.Next() {
+		key := iter.Val()
+		values, err := client.HGetAll(key).Result()
+		if err != nil {
+			return errors.Wrapf(err, "unable to get the key: %s", key)
+		} else if len(values) == 0 {
+			// the key expired during the scan
+			continue
+		}
+		if err := fn(strings.TrimPrefix(key, prefix), hashJSON(values)); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Migrate moves the calls stored by the previous versions of the agent, as JSON
+// strings at the top level of the database, to the hashes of the namespace, keeping
+// their expiration; it returns the number of migrated calls, and stops when the
+// context is canceled
+func (m *RedisManager) Migrate(context context.Context) (int, error) {
+	if m.client == nil {
+		return 0, errors.New("not connected")
+	}
+	var mutex sync.Mutex
+	migrated := 0
+	err := m.forEachNode(func(client redis.Cmdable) error {
+		iter := client.Scan(0, "", RedisScanCount).Iterator()
+		for iter.Next() {
+			if err := context.Err(); err != nil {
+				return err
+			}
+			key := iter.Val()
+			if m.options.KeyPrefix != "" && strings.HasPrefix(key, m.options.KeyPrefix) {
+				continue
+			}
+			ok, err := m.migrate(client, key)
+			if err != nil {
+				return errors.Wrapf(err, "unable to migrate the key: %s", key)
+			} else if ok {
+				mutex.Lock()
+				migrated++
+				mutex.Unlock()
+			}
+		}
+		return iter.Err()
+	})
+	return migrated, err
+}
+
+// migrate moves a legacy call, ignoring the keys which do not store a call
+func (m *RedisManager) migrate(client redis.Cmdable, key string) (bool, error) {
+	keyType, err := client.Type(key).Result()
+	if err != nil || keyType != "string" {
+		return false, err
+	}
+	dataJSON, err := client.Get(key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var call map[string]json.RawMessage
+	if json.Unmarshal(dataJSON, &call) != nil || call["transaction_tag"] == nil || call["cseq"] == nil {
+		return false, nil
+	}
+	ttl, err := client.PTTL(key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	values := make(map[string]interface{}, len(call))
+	for field, value := range call {
+		values[field] = []byte(value)
+	}
+	if err := m.setHash(m.key(key), values, ttl); err != nil {
+		return false, err
+	}
+	return true, client.Del(key).Err()
+}
+
+// forEachNode calls fn with the client of each master of the cluster, or with the
+// client of the server
+func (m *RedisManager) forEachNode(fn func(client redis.Cmdable) error) error {
+	if cluster, ok := m.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(client *redis.Client) error {
+			return fn(client)
+		})
+	}
+	return fn(m.client)
+}
+
+// key returns the Redis key of a key, made of the prefix and the namespace
+func (m *RedisManager) key(key string) string {
+	if m.options.Namespace == "" {
+		return m.options.KeyPrefix + key
+	}
+	return m.options.KeyPrefix + m.options.Namespace + ":" + key
+}
+
+// pattern returns the SCAN pattern of the keys of the namespace
+func (m *RedisManager) pattern() string {
+	return redisGlobEscaper.Replace(m.key("")) + "*"
+}
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// hashValues returns the fields of the hash storing some data
+func hashValues(data interface{}) (map[string]interface{}, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal request to JSON")
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(dataJSON, &fields) != nil || fields == nil {
+		return map[string]interface{}{RedisValueField: dataJSON}, nil
+	}
+	values := make(map[string]interface{}, len(fields))
+	for field, value := range fields {
+		values[field] = []byte(value)
+	}
+	if len(values) == 0 {
+		values[RedisValueField] = dataJSON
+	}
+	return values, nil
+}
+
+// hashJSON returns the JSON data stored in the fields of a hash
+func hashJSON(values map[string]string) []byte {
+	if value, ok := values[RedisValueField]; ok {
+		return []byte(value)
+	}
+	fields := make(map[string]json.RawMessage, len(values))
+	for field, value := range values {
+		fields[field] = json.RawMessage(value)
+	}
+	dataJSON, _ := json.Marshal(fields)
+	return dataJSON
+}
+
+// flush deletes the keys of the namespace
+func (m *RedisManager) flush(context context.Context) {
+	m.forEachNode(func(client redis.Cmdable) error {
+		iter := client.Scan(0, m.pattern(), RedisScanCount).Iterator()
+		for iter.Next() {
+			client.Del(iter.Val())
+		}
+		return iter.Err()
+	})
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"flag"
 	"testing"
+	"time"
 
+	"github.com/go-redis/redis/v7"
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/stretchr/testify/assert"
 
@@ -49,6 +51,59 @@ func TestNewRedisManagerConnectionFailed(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestNewRedisManagerConnectRetries(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	mgr := NewRedisManagerWithOptions(RedisOptions{
+		Address:             "localhost:1234",
+		ConnectRetries:      2,
+		ConnectRetryBackoff: 20 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	start := time.Now()
+	err := mgr.Connect(ctx)
+	assert.NotNil(t, err)
+	// the retries wait 20 and 40 milliseconds
+	assert.True(t, time.Since(start) >= 60*time.Millisecond)
+
+	mgr.options.ConnectRetries = 100
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = mgr.Connect(ctx)
+	assert.EqualError(t, err, "unable to connect to redis: context deadline exceeded")
+}
+
+func TestRedisManagerNewClient(t *testing.T) {
+	mgr := NewRedisManagerWithOptions(RedisOptions{
+		ClusterAddresses: []string{"localhost:7000", "localhost:7001"},
+	})
+	client, err := mgr.newClient()
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+	client.Close()
+
+	mgr = NewRedisManagerWithOptions(RedisOptions{
+		MasterName:        "mymaster",
+		SentinelAddresses: []string{"localhost:26379"},
+	})
+	client, err = mgr.newClient()
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+	client.Close()
+
+	mgr = NewRedisManagerWithOptions(RedisOptions{
+		Address:   "localhost:6379",
+		TLS:       true,
+		TLSCAFile: "missing.pem",
+	})
+	_, err = mgr.newClient()
+	assert.EqualError(t, err, "unable to read the redis CA file: open missing.pem: no such file or directory")
+}
+
 func TestRedisManagerGetSetDeleteInt(t *testing.T) {
 	flag.Parse()
 	if testing.Short() {
@@ -64,7 +119,7 @@ func TestRedisManagerGetSetDeleteInt(t *testing.T) {
 	ctx := context.Background()
 	mgr.Connect(ctx)
 	defer mgr.Close(ctx)
-	mgr.flushAll(ctx)
+	mgr.flush(ctx)
 
 	var ret int
 	err := mgr.Get(ctx, "key", &ret)
@@ -101,7 +156,7 @@ func TestRedisManagerGetSetDeleteString(t *testing.T) {
 	ctx := context.Background()
 	mgr.Connect(ctx)
 	defer mgr.Close(ctx)
-	mgr.flushAll(ctx)
+	mgr.flush(ctx)
 
 	var ret string
 	err := mgr.Get(ctx, "key", &ret)
@@ -121,3 +176,299 @@ func TestRedisManagerGetSetDeleteString(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "", ret)
 }
+
+func TestRedisManagerCount(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	redisAddress := config.Config.GetString(dconfig.SettingRedisAddress)
+	redisPassword := config.Config.GetString(dconfig.SettingRedisPassword)
+	redisDb := config.Config.GetInt(dconfig.SettingRedisDb)
+
+	mgr := NewRedisManager(redisAddress, redisPassword, redisDb)
+
+	ctx := context.Background()
+	_, err := mgr.Count(ctx)
+	assert.NotNil(t, err)
+
+	mgr.Connect(ctx)
+	defer mgr.Close(ctx)
+	mgr.flush(ctx)
+
+	mgr.Set(ctx, "key1", 1, 0)
+	mgr.Set(ctx, "key2", 2, 0)
+
+	count, err := mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestRedisManagerPing(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	redisAddress := config.Config.GetString(dconfig.SettingRedisAddress)
+	redisPassword := config.Config.GetString(dconfig.SettingRedisPassword)
+	redisDb := config.Config.GetInt(dconfig.SettingRedisDb)
+
+	mgr := NewRedisManager(redisAddress, redisPassword, redisDb)
+
+	ctx := context.Background()
+	err := mgr.Ping(ctx)
+	assert.NotNil(t, err)
+
+	mgr.Connect(ctx)
+	defer mgr.Close(ctx)
+
+	err = mgr.Ping(ctx)
+	assert.Nil(t, err)
+}
+
+func TestRedisManagerScan(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	redisAddress := config.Config.GetString(dconfig.SettingRedisAddress)
+	redisPassword := config.Config.GetString(dconfig.SettingRedisPassword)
+	redisDb := config.Config.GetInt(dconfig.SettingRedisDb)
+
+	mgr := NewRedisManager(redisAddress, redisPassword, redisDb)
+
+	ctx := context.Background()
+	err := mgr.Scan(ctx, func(key string, data []byte) error {
+		return nil
+	})
+	assert.NotNil(t, err)
+
+	mgr.Connect(ctx)
+	defer mgr.Close(ctx)
+	mgr.flush(ctx)
+
+	mgr.Set(ctx, "key1", 1, 0)
+	mgr.Set(ctx, "key2", 2, 0)
+
+	found := map[string]string{}
+	err = mgr.Scan(ctx, func(key string, data []byte) error {
+		found[key] = string(data)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key1": "1", "key2": "2"}, found)
+}
+
+func newTestRedisManager(t *testing.T, keyPrefix, namespace string) *RedisManager {
+	mgr := NewRedisManagerWithOptions(RedisOptions{
+		Address:   config.Config.GetString(dconfig.SettingRedisAddress),
+		Password:  config.Config.GetString(dconfig.SettingRedisPassword),
+		DB:        config.Config.GetInt(dconfig.SettingRedisDb),
+		KeyPrefix: keyPrefix,
+		Namespace: namespace,
+	})
+	err := mgr.Connect(context.Background())
+	assert.Nil(t, err)
+	return mgr
+}
+
+func TestRedisManagerNamespace(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	mgr := newTestRedisManager(t, "test:", "tenant1")
+	defer mgr.Close(ctx)
+	other := newTestRedisManager(t, "test:", "tenant2")
+	defer other.Close(ctx)
+	mgr.flush(ctx)
+	other.flush(ctx)
+
+	mgr.Set(ctx, "call-1", map[string]interface{}{"cseq": "1", "account_tag": "1000"}, 0)
+	other.Set(ctx, "call-1", map[string]interface{}{"cseq": "2"}, 0)
+	other.Set(ctx, "call-2", map[string]interface{}{"cseq": "3"}, 0)
+
+	values, err := mgr.client.HGetAll("test:tenant1:call-1").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"cseq": `"1"`, "account_tag": `"1000"`}, values)
+
+	count, err := mgr.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, err = other.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	found := map[string]string{}
+	err = mgr.Scan(ctx, func(key string, data []byte) error {
+		found[key] = string(data)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"call-1": `{"account_tag":"1000","cseq":"1"}`}, found)
+
+	mgr.flush(ctx)
+	count, err = other.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	other.flush(ctx)
+}
+
+func TestRedisManagerUpdate(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	mgr := newTestRedisManager(t, "test:", "default")
+	defer mgr.Close(ctx)
+	mgr.flush(ctx)
+
+	type call struct {
+		CSeq string `json:"cseq"`
+		Code int    `json:"final_code"`
+	}
+
+	err := mgr.Update(ctx, "call-1", map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	exists, _ := mgr.client.Exists("test:default:call-1").Result()
+	assert.Equal(t, int64(0), exists)
+
+	mgr.Set(ctx, "call-1", &call{CSeq: "1"}, 0)
+	err = mgr.Update(ctx, "call-1", map[string]interface{}{"final_code": 486}, 60)
+	assert.Nil(t, err)
+
+	ret := &call{}
+	err = mgr.Get(ctx, "call-1", ret)
+	assert.Nil(t, err)
+	assert.Equal(t, &call{CSeq: "1", Code: 486}, ret)
+
+	ttl, _ := mgr.client.TTL("test:default:call-1").Result()
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+}
+
+func TestRedisManagerUpdateIf(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	mgr := newTestRedisManager(t, "test:", "default")
+	defer mgr.Close(ctx)
+	mgr.flush(ctx)
+
+	type call struct {
+		CSeq         string    `json:"cseq"`
+		TimestampAck time.Time `json:"timestamp_ack"`
+	}
+
+	conditions := map[string]interface{}{"timestamp_ack": time.Time{}}
+	now := time.Date(2020, 3, 14, 8, 56, 8, 0, time.UTC)
+	updated, err := mgr.UpdateIf(ctx, "call-1", conditions, map[string]interface{}{"timestamp_ack": now}, 0)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	mgr.Set(ctx, "call-1", &call{CSeq: "1"}, 0)
+	updated, err = mgr.UpdateIf(ctx, "call-1", conditions, map[string]interface{}{"timestamp_ack": now}, 60)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	updated, err = mgr.UpdateIf(ctx, "call-1", conditions, map[string]interface{}{"timestamp_ack": now.Add(time.Second)}, 60)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	// a missing field matches nil
+	updated, err = mgr.UpdateIf(ctx, "call-1", map[string]interface{}{"final_code": nil},
+		map[string]interface{}{"final_code": 486}, 0)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	ret := &call{}
+	err = mgr.Get(ctx, "call-1", ret)
+	assert.Nil(t, err)
+	assert.Equal(t, &call{CSeq: "1", TimestampAck: now}, ret)
+
+	ttl, _ := mgr.client.TTL("test:default:call-1").Result()
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+}
+
+func TestRedisManagerSetIfNotExists(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	mgr := newTestRedisManager(t, "test:", "default")
+	defer mgr.Close(ctx)
+	mgr.flush(ctx)
+
+	set, err := mgr.SetIfNotExists(ctx, "key", true, 2)
+	assert.Nil(t, err)
+	assert.True(t, set)
+
+	set, err = mgr.SetIfNotExists(ctx, "key", false, 2)
+	assert.Nil(t, err)
+	assert.False(t, set)
+
+	var ret bool
+	err = mgr.Get(ctx, "key", &ret)
+	assert.Nil(t, err)
+	assert.True(t, ret)
+
+	ttl, _ := mgr.client.TTL("test:default:key").Result()
+	assert.True(t, ttl > 0 && ttl <= 2*time.Second)
+}
+
+func TestRedisManagerMigrate(t *testing.T) {
+	flag.Parse()
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	mgr := newTestRedisManager(t, "test:", "default")
+	defer mgr.Close(ctx)
+	mgr.client.FlushDB()
+
+	mgr.client.Set("call-1", `{"transaction_tag":"call-1","cseq":"1","account_tag":"1000"}`, time.Hour)
+	mgr.client.Set("call-2", `{"transaction_tag":"call-2","cseq":"2"}`, 0)
+	mgr.client.Set("other", `{"name":"value"}`, 0)
+	mgr.client.HSet("hash", "transaction_tag", "call-3")
+
+	migrated, err := mgr.Migrate(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, migrated)
+
+	keys, err := mgr.client.Keys("*").Result()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"test:default:call-1", "test:default:call-2", "other", "hash"}, keys)
+
+	found := map[string]string{}
+	mgr.Scan(ctx, func(key string, data []byte) error {
+		found[key] = string(data)
+		return nil
+	})
+	assert.Equal(t, map[string]string{
+		"call-1": `{"account_tag":"1000","cseq":"1","transaction_tag":"call-1"}`,
+		"call-2": `{"cseq":"2","transaction_tag":"call-2"}`,
+	}, found)
+
+	ttl, _ := mgr.client.TTL("test:default:call-1").Result()
+	assert.True(t, ttl > 59*time.Minute)
+	ttl, _ = mgr.client.TTL("test:default:call-2").Result()
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	// the migration is idempotent
+	migrated, err = mgr.Migrate(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, migrated)
+	mgr.client.FlushDB()
+}